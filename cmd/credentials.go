@@ -0,0 +1,58 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/davidcassany/ocistore/pkg/ocistore"
+	"github.com/spf13/cobra"
+)
+
+// addCredentialsFlags adds the flags to authenticate against a registry
+func addCredentialsFlags(cmd *cobra.Command) {
+	cmd.Flags().String("username", "", "User name to authenticate against the registry, requires --password-stdin")
+	cmd.Flags().Bool("password-stdin", false, "Reads the registry password from the standard input, or an identity token if no user name is given")
+}
+
+// credentialsFromFlags returns the credentials given by flags, nil if none was given so the
+// store credentials apply
+func credentialsFromFlags(cmd *cobra.Command) (*ocistore.Credentials, error) {
+	flags := cmd.Flags()
+	username, _ := flags.GetString("username")
+	passwordStdin, _ := flags.GetBool("password-stdin")
+
+	if !passwordStdin {
+		if username != "" {
+			return nil, errors.New("--username requires --password-stdin")
+		}
+		return nil, nil
+	}
+
+	password, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	secret := strings.TrimRight(string(password), "\r\n")
+	if secret == "" {
+		return nil, errors.New("empty password read from the standard input")
+	}
+	return &ocistore.Credentials{Username: username, Password: secret}, nil
+}
@@ -0,0 +1,79 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// dfCmd represents the df command
+var dfCmd = &cobra.Command{
+	Use:   "df",
+	Short: "Shows the disk space used by images, snapshots and content",
+	Long: `Shows the disk space used by the content store, each image and the active snapshots.
+SHARED is the part of an image also used by other images, EXCLUSIVE is the space released on
+garbage collection once the image is deleted`,
+	Args:    cobra.ExactArgs(0),
+	PreRunE: initSharedCS,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		format, _ := flags.GetString("format")
+
+		du, err := cs.DiskUsage()
+		if err != nil {
+			return err
+		}
+		if format != "" {
+			return printFormatted(du, format)
+		}
+
+		var tw = tabwriter.NewWriter(os.Stdout, 1, 4, 1, ' ', 0)
+		fmt.Fprintln(tw, "IMAGE\tCONTENT\tUNPACKED\tSHARED\tEXCLUSIVE")
+		for _, i := range du.Images {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", i.Name, humanSize(i.ContentSize),
+				humanSize(i.UnpackedSize), humanSize(i.Shared), humanSize(i.Exclusive))
+		}
+		if err = tw.Flush(); err != nil {
+			return err
+		}
+
+		if len(du.Snapshots) > 0 {
+			fmt.Println()
+			fmt.Fprintln(tw, "SNAPSHOT\tKIND\tSIZE\tINODES")
+			for _, s := range du.Snapshots {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", s.Key, s.Kind, humanSize(s.Size), s.Inodes)
+			}
+			if err = tw.Flush(); err != nil {
+				return err
+			}
+		}
+
+		fmt.Printf("\nContent: %s, snapshots: %s, reclaimable: %s\n",
+			humanSize(du.ContentSize), humanSize(du.SnapshotsSize), humanSize(du.Reclaimable))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dfCmd)
+
+	dfCmd.Flags().String("format", "", "Output format: 'json' or a Go template (default table)")
+}
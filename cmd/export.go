@@ -0,0 +1,74 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/davidcassany/ocistore/pkg/ocistore"
+	"github.com/spf13/cobra"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export -o FILE IMAGE_NAME...",
+	Short: "Exports the given images to an archive",
+	Long: `Exports the given images to an OCI archive, including a docker compatible manifest unless
+the oci format is requested. Exported archives can be imported back with 'import'`,
+	Args:    cobra.MinimumNArgs(1),
+	PreRunE: initSharedCS,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		output, _ := flags.GetString("output")
+		format, _ := flags.GetString("format")
+		platforms, _ := flags.GetStringSlice("platforms")
+		allPlatforms, _ := flags.GetBool("all-platforms")
+		gzip, _ := flags.GetBool("gzip")
+
+		opts := []ocistore.ExportOpt{ocistore.WithExportFormat(format)}
+		ps, err := parsePlatforms(platforms)
+		if err != nil {
+			return err
+		}
+		if len(ps) > 0 {
+			opts = append(opts, ocistore.WithExportPlatforms(ps...))
+		}
+		if allPlatforms {
+			opts = append(opts, ocistore.WithExportAllPlatforms())
+		}
+		if gzip {
+			opts = append(opts, ocistore.WithExportGzip())
+		}
+
+		if output == "-" {
+			return cs.Export(os.Stdout, args, opts...)
+		}
+		return cs.ExportFile(output, args, opts...)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringP("output", "o", "", "Archive file to write, '-' writes to the standard output")
+	exportCmd.Flags().String("format", ocistore.ExportFormatDocker, "Archive format: oci or docker")
+	exportCmd.Flags().StringSlice("platforms", []string{}, "Platforms to export from multi-platform images (defaults to --platform)")
+	exportCmd.Flags().Bool("all-platforms", false, "Exports all platforms of multi-platform images")
+	exportCmd.Flags().Bool("gzip", false, "Compresses the archive with gzip")
+	exportCmd.MarkFlagRequired("output")
+	exportCmd.MarkFlagsMutuallyExclusive("platforms", "all-platforms")
+}
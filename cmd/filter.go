@@ -0,0 +1,97 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/containerd/containerd/v2/pkg/filters"
+)
+
+// Fields the containerd filters of each kind of object can match
+var (
+	imageFilterKeys    = []string{"name", "target", "labels", "annotations"}
+	snapshotFilterKeys = []string{"kind", "name", "parent", "labels"}
+	leaseFilterKeys    = []string{"id", "labels"}
+)
+
+// validateFilters checks the given containerd filters are well formed and only match the given
+// fields, as filters on unknown fields silently match nothing
+func validateFilters(fs []string, keys []string) error {
+	for _, f := range fs {
+		if _, err := filters.Parse(f); err != nil {
+			return fmt.Errorf("invalid filter '%s': %w", f, err)
+		}
+		for _, key := range filterKeys(f) {
+			if !slices.Contains(keys, key) {
+				return fmt.Errorf("invalid filter '%s', unknown field '%s', expected one of: %s", f, key, strings.Join(keys, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// filterKeys returns the first field of every selector of the given well formed filter, e.g.
+// 'labels' for 'labels."x"==y'
+func filterKeys(f string) []string {
+	var keys []string
+	for i := 0; i < len(f); i++ {
+		for i < len(f) && f[i] == ' ' {
+			i++
+		}
+		start := i
+		for i < len(f) && isFieldChar(f[i]) {
+			i++
+		}
+		keys = append(keys, f[start:i])
+
+		// Skip the rest of the selector, separators within quoted parts included
+		var last byte
+		for ; i < len(f) && f[i] != ','; i++ {
+			if isQuoteChar(f[i]) && strings.IndexByte(".=~", last) >= 0 {
+				i = skipQuoted(f, i)
+			}
+			if f[i] != ' ' {
+				last = f[i]
+			}
+		}
+	}
+	return keys
+}
+
+// skipQuoted returns the position of the quote closing the quoted string starting at i
+func skipQuoted(f string, i int) int {
+	quote := f[i]
+	for i++; i < len(f); i++ {
+		if f[i] == '\\' {
+			i++
+		} else if f[i] == quote {
+			return i
+		}
+	}
+	return len(f) - 1
+}
+
+func isFieldChar(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+func isQuoteChar(c byte) bool {
+	return c == '"' || c == '/' || c == '|'
+}
@@ -0,0 +1,71 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFilterKeys(t *testing.T) {
+	for filter, want := range map[string][]string{
+		"name==alpine":                      {"name"},
+		"name~=^docker.io/":                 {"name"},
+		`labels."x"==y`:                     {"labels"},
+		`labels."a.b,c"==y`:                 {"labels"},
+		"target.digest==" + testDigest:      {"target"},
+		`name==alpine,labels."x"`:           {"name", "labels"},
+		`name~="a,b",labels.x==y`:           {"name", "labels"},
+		`name~=/^docker.io\/[a-z,]+/,id==x`: {"name", "id"},
+		"kind==active, parent==base":        {"kind", "parent"},
+		"annotations.|org.key|==value":      {"annotations"},
+	} {
+		if got := filterKeys(filter); !slices.Equal(got, want) {
+			t.Errorf("%s: expected keys %v, got %v", filter, want, got)
+		}
+	}
+}
+
+func TestValidateFilters(t *testing.T) {
+	for name, tc := range map[string]struct {
+		filters []string
+		keys    []string
+		err     string
+	}{
+		"none":             {nil, imageFilterKeys, ""},
+		"image name":       {[]string{"name~=^docker.io/"}, imageFilterKeys, ""},
+		"image labels":     {[]string{`labels."x"==y`, "target.digest==" + testDigest}, imageFilterKeys, ""},
+		"image annotation": {[]string{`annotations."org.key"`}, imageFilterKeys, ""},
+		"snapshot kind":    {[]string{"kind==active,parent==base"}, snapshotFilterKeys, ""},
+		"lease id":         {[]string{"id==KEY"}, leaseFilterKeys, ""},
+		"unknown key":      {[]string{"foo==bar"}, imageFilterKeys, "unknown field 'foo'"},
+		"unknown second":   {[]string{"name==a,tag==b"}, imageFilterKeys, "unknown field 'tag'"},
+		"unknown repeated": {[]string{"name==a", "kind==active"}, imageFilterKeys, "unknown field 'kind'"},
+		"image key":        {[]string{"name==a"}, leaseFilterKeys, "expected one of: id, labels"},
+		"bad operator":     {[]string{"name=>a"}, imageFilterKeys, "invalid filter 'name=>a'"},
+		"unclosed quote":   {[]string{`labels."x==y`}, imageFilterKeys, "invalid filter"},
+		"empty":            {[]string{""}, imageFilterKeys, ""},
+	} {
+		err := validateFilters(tc.filters, tc.keys)
+		if tc.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		} else if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%s: expected error containing '%s', got %v", name, tc.err, err)
+		}
+	}
+}
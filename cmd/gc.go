@@ -0,0 +1,93 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/davidcassany/ocistore/pkg/ocistore"
+	"github.com/spf13/cobra"
+)
+
+// gcCmd represents the gc command
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Removes unreferenced content, snapshots and expired leases",
+	Long: `Removes the content blobs, snapshots and expired leases no longer referenced by any image or
+lease of any namespace and reports the released disk space`,
+	Args: cobra.ExactArgs(0),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			return initSharedCS(cmd, args)
+		}
+		return initCS(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		dryRun, _ := flags.GetBool("dry-run")
+
+		var opts []ocistore.GCOpt
+		if dryRun {
+			opts = append(opts, ocistore.WithGCDryRun())
+		}
+
+		report, err := cs.GarbageCollect(opts...)
+		if err != nil {
+			return err
+		}
+
+		action := "Removed"
+		if report.DryRun {
+			action = "Would remove"
+		}
+
+		var tw = tabwriter.NewWriter(os.Stdout, 1, 4, 1, ' ', 0)
+		for _, ct := range report.Content {
+			if ct.Ref != "" {
+				fmt.Fprintf(tw, "ingest\t%s\t%s\n", ct.Ref, humanSize(ct.Size))
+				continue
+			}
+			fmt.Fprintf(tw, "blob\t%s\t%s\n", ct.Digest, humanSize(ct.Size))
+		}
+		for _, s := range report.Snapshots {
+			name := s.Name
+			if s.Key != "" {
+				name = s.Namespace + "/" + s.Key
+			}
+			fmt.Fprintf(tw, "snapshot\t%s\t%s\n", name, humanSize(s.Size))
+		}
+		for _, l := range report.Leases {
+			fmt.Fprintf(tw, "lease\t%s/%s\t\n", l.Namespace, l.ID)
+		}
+		if err = tw.Flush(); err != nil {
+			return err
+		}
+
+		fmt.Printf(
+			"%s %d blob(s), %d snapshot(s) and %d lease(s), %s released\n", action,
+			len(report.Content), len(report.Snapshots), len(report.Leases), humanSize(report.Bytes),
+		)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+	gcCmd.Flags().Bool("dry-run", false, "Reports what would be removed without removing anything")
+}
@@ -0,0 +1,78 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:     "history IMAGE_NAME",
+	Short:   "Shows the history of the given image",
+	Long:    `Shows the history records of the given image, newest first, with the layer each record created`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: initSharedCS,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		format, _ := flags.GetString("format")
+		noTrunc, _ := flags.GetBool("no-trunc")
+
+		entries, err := cs.History(args[0])
+		if err != nil {
+			return err
+		}
+		if format != "" {
+			return printFormatted(entries, format)
+		}
+
+		var tw = tabwriter.NewWriter(os.Stdout, 1, 4, 1, ' ', 0)
+		fmt.Fprintln(tw, "CREATED\tCREATED BY\tLAYER\tSIZE\tAUTHOR\tCOMMENT")
+		for i := len(entries) - 1; i >= 0; i-- {
+			e := entries[i]
+			created := "<missing>"
+			if e.Created != nil {
+				created = e.Created.Local().Format(time.RFC3339)
+			}
+			layer, size := "<empty>", "0B"
+			if e.Layer != nil {
+				layer, size = e.Layer.Digest.String(), humanSize(e.Layer.Size)
+				if !noTrunc {
+					layer = e.Layer.Digest.Encoded()[:12]
+				}
+			}
+			createdBy := e.CreatedBy
+			if !noTrunc && len(createdBy) > 45 {
+				createdBy = createdBy[:44] + "…"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", created, createdBy, layer, size, e.Author, e.Comment)
+		}
+		return tw.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().String("format", "", "Output format: 'json' or a Go template (default table)")
+	historyCmd.Flags().Bool("no-trunc", false, "Do not truncate the output")
+}
@@ -31,14 +31,22 @@ var importCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		flags := cmd.Flags()
 		unpack, _ := flags.GetBool("unpack")
+		platforms, _ := flags.GetStringSlice("platforms")
 		file := args[0]
 
 		opts := []ocistore.ImportOpt{}
+		ps, err := parsePlatforms(platforms)
+		if err != nil {
+			return err
+		}
+		if len(ps) > 0 {
+			opts = append(opts, ocistore.WithImportPlatforms(ps...))
+		}
 		if unpack {
 			opts = append(opts, ocistore.WithImportUnpack())
 		}
 
-		_, err := cs.ImportFile(file, opts...)
+		_, err = cs.ImportFile(file, opts...)
 		if err != nil {
 			return err
 		}
@@ -51,4 +59,5 @@ func init() {
 	rootCmd.AddCommand(importCmd)
 
 	importCmd.Flags().Bool("unpack", false, "Unpacks imported images")
+	importCmd.Flags().StringSlice("platforms", []string{}, "Platforms to import, images are unpacked for the first one (defaults to --platform)")
 }
@@ -0,0 +1,54 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/davidcassany/ocistore/pkg/ocistore"
+	"github.com/spf13/cobra"
+)
+
+// inspectCmd represents the inspect command
+var inspectCmd = &cobra.Command{
+	Use:   "inspect IMAGE_NAME",
+	Short: "Shows the index, manifests, config, layers and unpack state of the given image",
+	Long: `Shows the details of the given image for all its platforms. The output is JSON unless
+a Go template is given with --format, e.g. --format '{{range .Manifests}}{{.ChainID}} {{.Unpacked}}{{end}}'`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: initSharedCS,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		format, _ := flags.GetString("format")
+		decompress, _ := flags.GetBool("decompress")
+
+		var opts []ocistore.InspectOpt
+		if decompress {
+			opts = append(opts, ocistore.WithInspectDecompress())
+		}
+		details, err := cs.Inspect(args[0], opts...)
+		if err != nil {
+			return err
+		}
+		return printFormatted(details, format)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(inspectCmd)
+
+	inspectCmd.Flags().String("format", "json", "Output format: 'json' or a Go template")
+	inspectCmd.Flags().Bool("decompress", false, "Decompress layers to compute their uncompressed size if it is not known otherwise")
+}
@@ -0,0 +1,134 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/davidcassany/ocistore/pkg/ocistore"
+	"github.com/spf13/cobra"
+)
+
+// leaseCmd represents the lease command
+var leaseCmd = &cobra.Command{
+	Use:   "lease",
+	Short: "Manages the leases protecting content and snapshots from garbage collection",
+}
+
+// leaseListCmd represents the lease list command
+var leaseListCmd = &cobra.Command{
+	Use:     "list [FILTER...]",
+	Aliases: []string{"ls"},
+	Short:   "Lists all leases",
+	Long:    `Lists all leases of the namespace, optionally matching the given containerd filters, e.g. 'id==KEY'`,
+	PreRunE: initSharedCS,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateFilters(args, leaseFilterKeys); err != nil {
+			return err
+		}
+
+		ls, err := cs.ListLeases(args...)
+		if err != nil {
+			return err
+		}
+
+		var tw = tabwriter.NewWriter(os.Stdout, 1, 4, 1, ' ', 0)
+		fmt.Fprintln(tw, "ID\tCREATED\tEXPIRES\tRESOURCES")
+		for _, l := range ls {
+			expires := "never"
+			if l.Expired() {
+				expires = "expired"
+			} else if !l.Expires.IsZero() {
+				expires = l.Expires.Local().Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", l.ID, l.CreatedAt.Local().Format(time.RFC3339), expires, len(l.Resources))
+		}
+		return tw.Flush()
+	},
+}
+
+// leaseInspectCmd represents the lease inspect command
+var leaseInspectCmd = &cobra.Command{
+	Use:     "inspect LEASE_ID",
+	Short:   "Shows the labels and resources of the given lease",
+	Args:    cobra.ExactArgs(1),
+	PreRunE: initSharedCS,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		l, err := cs.GetLease(args[0])
+		if err != nil {
+			return err
+		}
+		return printLease(l)
+	},
+}
+
+// leaseRemoveCmd represents the lease remove command
+var leaseRemoveCmd = &cobra.Command{
+	Use:     "remove LEASE_ID...",
+	Aliases: []string{"rm"},
+	Short:   "Removes the given leases",
+	Long:    `Removes the given leases, the content and snapshots they protected are released on next garbage collection`,
+	Args:    cobra.MinimumNArgs(1),
+	PreRunE: initCS,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var errs []error
+		for _, id := range args {
+			errs = append(errs, cs.DeleteLease(id))
+		}
+		return errors.Join(errs...)
+	},
+}
+
+// leaseExtendCmd represents the lease extend command
+var leaseExtendCmd = &cobra.Command{
+	Use:     "extend LEASE_ID",
+	Short:   "Extends the expiration of the given lease",
+	Long:    `Sets the expiration of the given lease to the given duration from now`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: initCS,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		duration, _ := flags.GetDuration("duration")
+
+		l, err := cs.ExtendLease(args[0], duration)
+		if err != nil {
+			return err
+		}
+		return printLease(l)
+	},
+}
+
+func printLease(l ocistore.LeaseInfo) error {
+	jsonStr, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(jsonStr))
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(leaseCmd)
+	leaseCmd.AddCommand(leaseListCmd, leaseInspectCmd, leaseRemoveCmd, leaseExtendCmd)
+
+	leaseExtendCmd.Flags().Duration("duration", ocistore.DefaultMountLease, "Time from now until the lease expires")
+}
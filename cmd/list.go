@@ -17,10 +17,10 @@ limitations under the License.
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"text/tabwriter"
+	"time"
 
 	"github.com/containerd/containerd/v2/core/images"
 	"github.com/spf13/cobra"
@@ -28,44 +28,59 @@ import (
 
 // listCmd represents the list command
 var listCmd = &cobra.Command{
-	Use:     "list",
-	Short:   "Lists all images",
+	Use:   "list",
+	Short: "Lists all images",
+	Long: `Lists all images matching the given filters. Filters use the containerd
+filter syntax, multiple --filter flags are combined with OR, for instance:
+
+  ocistore list --filter 'name~=^docker.io/' --filter 'labels."x"==y'`,
 	Args:    cobra.ExactArgs(0),
-	PreRunE: initCS,
+	PreRunE: initSharedCS,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		flags := cmd.Flags()
-		imgs, err := cs.List()
-		jOut, _ := flags.GetBool("json")
+		filters, _ := flags.GetStringArray("filter")
+		output, _ := flags.GetString("output")
+		quiet, _ := flags.GetBool("quiet")
+		if jOut, _ := flags.GetBool("json"); jOut {
+			output = "json"
+		}
+		if err := validateFilters(filters, imageFilterKeys); err != nil {
+			return err
+		}
+
+		imgs, err := cs.List(filters...)
 		if err != nil {
 			return err
 		}
 
-		var tw = tabwriter.NewWriter(os.Stdout, 1, 4, 1, ' ', 0)
-		var images []images.Image
+		if quiet {
+			for _, img := range imgs {
+				fmt.Println(img.Name())
+			}
+			return nil
+		}
 
+		images := []images.Image{}
 		for _, img := range imgs {
-			if !jOut {
-				fmt.Fprintf(tw, "\t%s\t%s\n", img.Name(), img.Metadata().Target.Digest)
-			} else {
-				images = append(images, img.Metadata())
-			}
+			images = append(images, img.Metadata())
 		}
 
-		if !jOut {
-			tw.Flush()
-		} else {
-			jsonBytes, err := json.MarshalIndent(images, "", "  ")
-			if err != nil {
-				return err
+		return printOutput(images, output, func() error {
+			var tw = tabwriter.NewWriter(os.Stdout, 1, 4, 1, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tDIGEST\tCREATED")
+			for _, img := range images {
+				fmt.Fprintf(tw, "%s\t%s\t%s\n", img.Name, img.Target.Digest, img.CreatedAt.Local().Format(time.RFC3339))
 			}
-			fmt.Println(string(jsonBytes))
-		}
-		return nil
+			return tw.Flush()
+		})
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(listCmd)
 
+	listCmd.Flags().StringArray("filter", []string{}, "Filter images with containerd filters syntax, can be repeated")
+	addOutputFlags(listCmd, "Only print image names")
 	listCmd.Flags().Bool("json", false, "Outpus images metadata in a json")
+	_ = listCmd.Flags().MarkDeprecated("json", "use --output json instead")
 }
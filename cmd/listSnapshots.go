@@ -16,32 +16,62 @@ limitations under the License.
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
 
+	"github.com/containerd/containerd/v2/core/snapshots"
 	"github.com/spf13/cobra"
 )
 
 // listSnapshotsCmd represents the listSnapshots command
 var listSnapshotsCmd = &cobra.Command{
-	Use:     "list-snapshots",
-	Short:   "Lists all available snapshots",
-	PreRunE: initCS,
+	Use:   "list-snapshots",
+	Short: "Lists all available snapshots",
+	Long: `Lists all available snapshots matching the given filters. Filters use the
+containerd filter syntax, multiple --filter flags are combined with OR, for instance:
+
+  ocistore list-snapshots --filter kind==active --filter 'labels."x"==y'`,
+	PreRunE: initSharedCS,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		snaps, err := cs.ListSnapshots()
-		if err != nil {
+		flags := cmd.Flags()
+		filters, _ := flags.GetStringArray("filter")
+		output, _ := flags.GetString("output")
+		quiet, _ := flags.GetBool("quiet")
+		if err := validateFilters(filters, snapshotFilterKeys); err != nil {
 			return err
 		}
 
-		jsonStr, err := json.MarshalIndent(snaps, "", "  ")
+		snaps, err := cs.ListSnapshots(filters...)
 		if err != nil {
 			return err
 		}
-		fmt.Println(string(jsonStr))
-		return nil
+		if snaps == nil {
+			snaps = []snapshots.Info{}
+		}
+
+		if quiet {
+			for _, s := range snaps {
+				fmt.Println(s.Name)
+			}
+			return nil
+		}
+
+		return printOutput(snaps, output, func() error {
+			var tw = tabwriter.NewWriter(os.Stdout, 1, 4, 1, ' ', 0)
+			fmt.Fprintln(tw, "KEY\tKIND\tPARENT\tCREATED")
+			for _, s := range snaps {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Name, s.Kind, s.Parent, s.Created.Local().Format(time.RFC3339))
+			}
+			return tw.Flush()
+		})
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(listSnapshotsCmd)
+
+	listSnapshotsCmd.Flags().StringArray("filter", []string{}, "Filter snapshots with containerd filters syntax, can be repeated")
+	addOutputFlags(listSnapshotsCmd, "Only print snapshot keys")
 }
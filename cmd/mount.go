@@ -35,13 +35,19 @@ var mountCmd = &cobra.Command{
 		key, _ := flags.GetString("snapshot-key")
 		name, _ := flags.GetString("image")
 		scratch, _ := flags.GetBool("from-scratch")
+		policy, _ := flags.GetString("policy")
 		target := args[0]
 
 		var img client.Image
 		var err error
 
+		mOpts := []ocistore.MountOpt{}
+		if policy != "" {
+			mOpts = append(mOpts, ocistore.WithMountPolicy(policy))
+		}
+
 		if scratch {
-			key, err = cs.MountFromScratch(target, key)
+			key, err = cs.MountFromScratch(target, key, mOpts...)
 			if err != nil {
 				return err
 			}
@@ -49,7 +55,6 @@ var mountCmd = &cobra.Command{
 			return nil
 		}
 
-		mOpts := []ocistore.MountOpt{}
 		if unpack {
 			mOpts = append(mOpts, ocistore.WithMountUnpack())
 		}
@@ -76,6 +81,7 @@ func init() {
 	mountCmd.Flags().Bool("read-only", false, "Set the mount as a read-only mount")
 	mountCmd.Flags().Bool("from-scratch", false, "Sets the mount of a new snapshot without a base image, used to create images from scratch")
 	mountCmd.Flags().String("image", "", "Name of the image to mount")
+	mountCmd.Flags().String("policy", "", "What 'recover' does with the snapshot once no longer mounted: keep or discard")
 
 	mountCmd.MarkFlagsMutuallyExclusive("from-scratch", "image")
 	mountCmd.MarkFlagsMutuallyExclusive("from-scratch", "unpack")
@@ -0,0 +1,59 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// mountsCmd represents the mounts command
+var mountsCmd = &cobra.Command{
+	Use:     "mounts",
+	Short:   "Lists the mounts done by the store",
+	Args:    cobra.ExactArgs(0),
+	PreRunE: initSharedCS,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mounts, err := cs.ListMounts()
+		if err != nil {
+			return err
+		}
+
+		var tw = tabwriter.NewWriter(os.Stdout, 1, 4, 1, ' ', 0)
+		fmt.Fprintln(tw, "TARGET\tKEY\tIMAGE\tMODE\tCREATED")
+		for _, m := range mounts {
+			mode := "rw"
+			if m.ReadOnly {
+				mode = "ro"
+			}
+			image := m.Image
+			if image == "" {
+				image = "<scratch>"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", m.Target, m.Key, image, mode, m.Created.Local().Format(time.RFC3339))
+		}
+		return tw.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mountsCmd)
+}
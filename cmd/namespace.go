@@ -0,0 +1,117 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// namespaceCmd represents the namespace command
+var namespaceCmd = &cobra.Command{
+	Use:     "namespace",
+	Aliases: []string{"ns"},
+	Short:   "Manages store namespaces",
+}
+
+// namespaceListCmd represents the namespace list command
+var namespaceListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "Lists all namespaces",
+	Args:    cobra.ExactArgs(0),
+	PreRunE: initSharedCS,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		nss, err := cs.ListNamespaces()
+		if err != nil {
+			return err
+		}
+
+		var tw = tabwriter.NewWriter(os.Stdout, 1, 4, 1, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tLABELS")
+		for _, ns := range nss {
+			labels, err := cs.GetNamespaceLabels(ns)
+			if err != nil {
+				return err
+			}
+			var lbls []string
+			for k, v := range labels {
+				lbls = append(lbls, k+"="+v)
+			}
+			sort.Strings(lbls)
+			fmt.Fprintf(tw, "%s\t%s\n", ns, strings.Join(lbls, ","))
+		}
+		return tw.Flush()
+	},
+}
+
+// namespaceCreateCmd represents the namespace create command
+var namespaceCreateCmd = &cobra.Command{
+	Use:     "create NAMESPACE",
+	Short:   "Creates a new namespace",
+	Args:    cobra.ExactArgs(1),
+	PreRunE: initCS,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		lbls, _ := flags.GetStringArray("label")
+
+		labels := map[string]string{}
+		for _, l := range lbls {
+			k, v, ok := strings.Cut(l, "=")
+			if !ok || k == "" {
+				return fmt.Errorf("invalid label '%s', expected 'key=value'", l)
+			}
+			labels[k] = v
+		}
+
+		return cs.CreateNamespace(args[0], labels)
+	},
+}
+
+// namespaceRemoveCmd represents the namespace remove command
+var namespaceRemoveCmd = &cobra.Command{
+	Use:     "remove NAMESPACE...",
+	Aliases: []string{"rm"},
+	Short:   "Removes the given namespaces",
+	Long:    `Namespaces are required to be empty unless --force is set, which removes all their images, snapshots and leases`,
+	Args:    cobra.MinimumNArgs(1),
+	PreRunE: initCS,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		force, _ := flags.GetBool("force")
+
+		var errs []error
+		for _, ns := range args {
+			errs = append(errs, cs.RemoveNamespace(ns, force))
+		}
+		return errors.Join(errs...)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(namespaceCmd)
+	namespaceCmd.AddCommand(namespaceListCmd, namespaceCreateCmd, namespaceRemoveCmd)
+
+	namespaceCreateCmd.Flags().StringArray("label", []string{}, "Label to set on the namespace in 'key=value' format, can be repeated")
+	namespaceRemoveCmd.Flags().Bool("force", false, "Removes all images, snapshots and leases of the namespace")
+}
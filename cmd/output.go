@@ -0,0 +1,100 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+const goTemplatePrefix = "go-template="
+
+// addOutputFlags adds the --output and --quiet flags to list commands
+func addOutputFlags(cmd *cobra.Command, quietUsage string) {
+	cmd.Flags().StringP("output", "o", "table", "Output format: table, json, yaml or go-template=TEMPLATE")
+	cmd.Flags().BoolP("quiet", "q", false, quietUsage)
+	cmd.MarkFlagsMutuallyExclusive("output", "quiet")
+}
+
+// printOutput prints v in the given output format, table prints the table instead
+func printOutput(v any, output string, table func() error) error {
+	switch {
+	case output == "" || output == "table":
+		return table()
+	case output == "json":
+		return printFormatted(v, "json")
+	case output == "yaml":
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(b))
+		return nil
+	case strings.HasPrefix(output, goTemplatePrefix):
+		return printFormatted(v, strings.TrimPrefix(output, goTemplatePrefix))
+	default:
+		return fmt.Errorf("invalid output format '%s', expected table, json, yaml or go-template=TEMPLATE", output)
+	}
+}
+
+// printFormatted prints v as indented JSON if format is empty or 'json', otherwise format is
+// executed as a Go template on v
+func printFormatted(v any, format string) error {
+	if format == "" || format == "json" {
+		jsonStr, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(jsonStr))
+		return nil
+	}
+
+	tmpl, err := template.New("format").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(format)
+	if err != nil {
+		return fmt.Errorf("invalid format template: %w", err)
+	}
+	if err = tmpl.Execute(os.Stdout, v); err != nil {
+		return err
+	}
+	fmt.Println()
+	return nil
+}
+
+// humanSize formats the given amount of bytes using binary units
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,182 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/spf13/cobra"
+)
+
+// captureStdout returns what f prints to stdout
+func captureStdout(t *testing.T, f func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	err = f()
+	w.Close()
+	return <-out, err
+}
+
+func TestPrintOutput(t *testing.T) {
+	imgs := []images.Image{{
+		Name:   "docker.io/library/alpine:latest",
+		Labels: map[string]string{"x": "y"},
+		Target: ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageIndex,
+			Digest:    digest.Digest(testDigest),
+			Size:      1024,
+		},
+		CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}}
+	table := func() error {
+		_, err := os.Stdout.WriteString("TABLE\n")
+		return err
+	}
+
+	for name, tc := range map[string]struct {
+		output string
+		want   string
+		err    string
+	}{
+		"default":      {"", "TABLE\n", ""},
+		"table":        {"table", "TABLE\n", ""},
+		"yaml":         {"yaml", "- CreatedAt: \"2024-01-02T03:04:05Z\"\n", ""},
+		"template":     {"go-template={{range .}}{{.Name}} {{.Target.Digest}}{{end}}", "docker.io/library/alpine:latest " + testDigest + "\n", ""},
+		"template fn":  {"go-template={{json (index . 0).Labels}}", "{\"x\":\"y\"}\n", ""},
+		"bad template": {"go-template={{.Name", "", "invalid format template"},
+		"invalid":      {"xml", "", "invalid output format 'xml'"},
+	} {
+		got, err := captureStdout(t, func() error { return printOutput(imgs, tc.output, table) })
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: expected error containing '%s', got %v", name, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		} else if !strings.HasPrefix(got, tc.want) {
+			t.Errorf("%s: expected output starting with %q, got %q", name, tc.want, got)
+		}
+	}
+
+	tableErr := errors.New("table failed")
+	if _, err := captureStdout(t, func() error {
+		return printOutput(imgs, "table", func() error { return tableErr })
+	}); !errors.Is(err, tableErr) {
+		t.Errorf("expected the table error, got %v", err)
+	}
+}
+
+func TestPrintOutputJSON(t *testing.T) {
+	imgs := []images.Image{{
+		Name: "docker.io/library/alpine:latest",
+		Target: ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageIndex,
+			Digest:    digest.Digest(testDigest),
+			Size:      1024,
+		},
+	}}
+	got, err := captureStdout(t, func() error { return printOutput(imgs, "json", nil) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out []map[string]json.RawMessage
+	if err = json.Unmarshal([]byte(got), &out); err != nil {
+		t.Fatalf("invalid JSON output %q: %v", got, err)
+	}
+	if len(out) != 1 {
+		t.Fatalf("expected a single image, got %d", len(out))
+	}
+	for _, key := range []string{"Name", "Labels", "Target", "CreatedAt", "UpdatedAt"} {
+		if _, ok := out[0][key]; !ok {
+			t.Errorf("expected key '%s' in JSON output %q", key, got)
+		}
+	}
+
+	var target ocispec.Descriptor
+	if err = json.Unmarshal(out[0]["Target"], &target); err != nil {
+		t.Fatal(err)
+	}
+	if target.Digest != testDigest || target.MediaType != ocispec.MediaTypeImageIndex || target.Size != 1024 {
+		t.Errorf("unexpected target in JSON output: %+v", target)
+	}
+}
+
+func TestOutputFlags(t *testing.T) {
+	for name, tc := range map[string]struct {
+		args   []string
+		output string
+		quiet  bool
+		err    bool
+	}{
+		"defaults": {nil, "table", false, false},
+		"output":   {[]string{"-o", "json"}, "json", false, false},
+		"quiet":    {[]string{"--quiet"}, "table", true, false},
+		"both":     {[]string{"-q", "--output", "yaml"}, "", false, true},
+	} {
+		var output string
+		var quiet bool
+		cmd := &cobra.Command{
+			Use: "test",
+			RunE: func(cmd *cobra.Command, args []string) error {
+				output, _ = cmd.Flags().GetString("output")
+				quiet, _ = cmd.Flags().GetBool("quiet")
+				return nil
+			},
+		}
+		addOutputFlags(cmd, "Only print names")
+		cmd.SetArgs(tc.args)
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+
+		err := cmd.Execute()
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: expected an error for mutually exclusive flags", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		} else if output != tc.output || quiet != tc.quiet {
+			t.Errorf("%s: expected output '%s' and quiet %v, got '%s' and %v", name, tc.output, tc.quiet, output, quiet)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/davidcassany/ocistore/pkg/ocistore"
+)
+
+const (
+	progressAuto  = "auto"
+	progressTTY   = "tty"
+	progressPlain = "plain"
+	progressJSON  = "json"
+	progressNone  = "none"
+
+	progressBarWidth = 30
+	progressRedraw   = 200 * time.Millisecond
+)
+
+// newProgressDisplay returns the callback printing pull progress events on stdout in the given
+// mode and a function to call once the pull is done. The auto mode is an interactive display
+// on terminals and prints nothing otherwise.
+func newProgressDisplay(mode string) (func(ocistore.ProgressEvent), func(), error) {
+	if mode == progressAuto {
+		mode = progressNone
+		if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+			mode = progressTTY
+		}
+	}
+
+	switch mode {
+	case progressNone:
+		return nil, func() {}, nil
+	case progressJSON:
+		enc := json.NewEncoder(os.Stdout)
+		return func(ev ocistore.ProgressEvent) { _ = enc.Encode(ev) }, func() {}, nil
+	case progressPlain:
+		return func(ev ocistore.ProgressEvent) {
+			if ev.Status != ocistore.ProgressDownloading {
+				fmt.Printf("%s: %s\n", ev.Ref, ev.Status)
+			}
+		}, func() {}, nil
+	case progressTTY:
+		d := &ttyDisplay{out: os.Stdout, events: map[string]ocistore.ProgressEvent{}}
+		return d.update, func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("invalid progress mode '%s', valid modes are: auto, tty, plain, json, none", mode)
+	}
+}
+
+// ttyDisplay redraws the state of all pulled descriptors in place. It draws from the progress
+// callback, so nothing is drawn once the pull returns and the final state is never redrawn over
+// the lines printed after it.
+type ttyDisplay struct {
+	out      io.Writer
+	lines    int
+	lastDraw time.Time
+	refs     []string
+	events   map[string]ocistore.ProgressEvent
+}
+
+func (d *ttyDisplay) update(ev ocistore.ProgressEvent) {
+	if _, ok := d.events[ev.Ref]; !ok {
+		d.refs = append(d.refs, ev.Ref)
+	}
+	d.events[ev.Ref] = ev
+
+	// Throttle byte count updates, state changes are always drawn
+	if ev.Status == ocistore.ProgressDownloading && time.Since(d.lastDraw) < progressRedraw {
+		return
+	}
+	d.draw()
+}
+
+func (d *ttyDisplay) draw() {
+	var buf bytes.Buffer
+	for i := 0; i < d.lines; i++ {
+		// Move the cursor up and clear the line
+		buf.WriteString("\x1b[1A\x1b[2K\r")
+	}
+
+	tw := tabwriter.NewWriter(&buf, 1, 4, 1, ' ', 0)
+	for _, ref := range d.refs {
+		ev := d.events[ref]
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", shortRef(ev), ev.Status, progressDetail(ev))
+	}
+	_ = tw.Flush()
+	d.lines = len(d.refs)
+	d.lastDraw = time.Now()
+
+	_, _ = d.out.Write(buf.Bytes())
+}
+
+// shortRef shortens the digest of descriptor references to fit the display
+func shortRef(ev ocistore.ProgressEvent) string {
+	if ev.Digest == "" || ev.Digest.Validate() != nil {
+		return ev.Ref
+	}
+	kind, _, _ := strings.Cut(ev.Ref, "-")
+	return kind + "-" + ev.Digest.Encoded()[:12]
+}
+
+func progressDetail(ev ocistore.ProgressEvent) string {
+	switch ev.Status {
+	case ocistore.ProgressDownloading, ocistore.ProgressVerifying:
+		done := 0
+		if ev.Total > 0 {
+			done = int(ev.Offset * progressBarWidth / ev.Total)
+		}
+		done = min(done, progressBarWidth)
+		bar := strings.Repeat("=", done) + strings.Repeat(" ", progressBarWidth-done)
+		return fmt.Sprintf("[%s] %s/%s", bar, humanSize(ev.Offset), humanSize(ev.Total))
+	case ocistore.ProgressDone, ocistore.ProgressExists:
+		if ev.Digest != "" {
+			return humanSize(ev.Total)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/davidcassany/ocistore/pkg/ocistore"
+)
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestProgressDetail(t *testing.T) {
+	for name, tc := range map[string]struct {
+		ev   ocistore.ProgressEvent
+		want string
+	}{
+		"resolving": {ocistore.ProgressEvent{Ref: "alpine", Status: ocistore.ProgressResolving}, ""},
+		"resolved":  {ocistore.ProgressEvent{Ref: "alpine", Status: ocistore.ProgressDone}, ""},
+		"waiting":   {ocistore.ProgressEvent{Digest: testDigest, Status: ocistore.ProgressWaiting, Total: 2048}, ""},
+		"started":   {ocistore.ProgressEvent{Digest: testDigest, Status: ocistore.ProgressDownloading, Total: 2048}, "[" + strings.Repeat(" ", 30) + "] 0B/2.0KiB"},
+		"half":      {ocistore.ProgressEvent{Digest: testDigest, Status: ocistore.ProgressDownloading, Offset: 1024, Total: 2048}, "[" + strings.Repeat("=", 15) + strings.Repeat(" ", 15) + "] 1.0KiB/2.0KiB"},
+		"no total":  {ocistore.ProgressEvent{Digest: testDigest, Status: ocistore.ProgressDownloading, Offset: 512}, "[" + strings.Repeat(" ", 30) + "] 512B/0B"},
+		"overflow":  {ocistore.ProgressEvent{Digest: testDigest, Status: ocistore.ProgressVerifying, Offset: 4096, Total: 2048}, "[" + strings.Repeat("=", 30) + "] 4.0KiB/2.0KiB"},
+		"done":      {ocistore.ProgressEvent{Digest: testDigest, Status: ocistore.ProgressDone, Offset: 3 << 20, Total: 3 << 20}, "3.0MiB"},
+		"exists":    {ocistore.ProgressEvent{Digest: testDigest, Status: ocistore.ProgressExists, Offset: 100, Total: 100}, "100B"},
+	} {
+		if got := progressDetail(tc.ev); got != tc.want {
+			t.Errorf("%s: expected detail '%s', got '%s'", name, tc.want, got)
+		}
+	}
+}
+
+func TestShortRef(t *testing.T) {
+	ev := ocistore.ProgressEvent{Ref: "layer-" + testDigest, Digest: testDigest}
+	if got := shortRef(ev); got != "layer-0123456789ab" {
+		t.Errorf("expected shortened reference, got '%s'", got)
+	}
+	ev = ocistore.ProgressEvent{Ref: "docker.io/library/alpine:latest"}
+	if got := shortRef(ev); got != ev.Ref {
+		t.Errorf("expected image reference unchanged, got '%s'", got)
+	}
+}
+
+func TestTTYDisplay(t *testing.T) {
+	var out bytes.Buffer
+	d := &ttyDisplay{out: &out, events: map[string]ocistore.ProgressEvent{}}
+	d.update(ocistore.ProgressEvent{Ref: "alpine", Status: ocistore.ProgressResolving})
+	d.update(ocistore.ProgressEvent{Ref: "alpine", Status: ocistore.ProgressDone})
+	d.update(ocistore.ProgressEvent{Ref: "layer-" + testDigest, Digest: testDigest, Status: ocistore.ProgressWaiting})
+
+	// Every draw clears the lines of the former one, the reference line is cleared twice
+	if n := strings.Count(out.String(), "\x1b[1A"); n != 2 {
+		t.Errorf("expected 2 cleared lines, got %d", n)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	last := lines[len(lines)-2:]
+	if !strings.Contains(last[0], "alpine") || !strings.Contains(last[0], "done") ||
+		!strings.Contains(last[1], "layer-0123456789ab") || !strings.Contains(last[1], "waiting") {
+		t.Errorf("unexpected display: %q", last)
+	}
+
+	if _, _, err := newProgressDisplay("fancy"); err == nil {
+		t.Error("expected an error for an invalid progress mode")
+	}
+}
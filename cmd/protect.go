@@ -0,0 +1,38 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// protectCmd represents the protect command
+var protectCmd = &cobra.Command{
+	Use:     "protect IMAGE_NAME",
+	Short:   "Protects an image from being pruned",
+	Args:    cobra.ExactArgs(1),
+	PreRunE: initCS,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		remove, _ := cmd.Flags().GetBool("remove")
+		return cs.ProtectImage(args[0], !remove)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(protectCmd)
+	protectCmd.Flags().Bool("remove", false, "Removes the protection of the image")
+}
@@ -0,0 +1,115 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/davidcassany/ocistore/pkg/ocistore"
+	"github.com/spf13/cobra"
+)
+
+// pruneCmd represents the prune command
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Removes unused images, snapshots and content",
+	Long: `Removes dangling images, or all images with --all, the snapshots nothing uses anymore and the
+content no longer referenced. Images protected with 'protect' and images in use by a mount are
+never pruned. The retention flags narrow down the pruned images, for instance to keep the 3
+newest commits labelled with x=y:
+
+  ocistore prune --all --filter 'labels."x"==y' --keep 3
+
+What is going to be removed is reported before removing anything`,
+	Args: cobra.ExactArgs(0),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			return initSharedCS(cmd, args)
+		}
+		return initCS(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		dryRun, _ := flags.GetBool("dry-run")
+		all, _ := flags.GetBool("all")
+		filters, _ := flags.GetStringArray("filter")
+		keep, _ := flags.GetInt("keep")
+		olderThan, _ := flags.GetDuration("older-than")
+		if err := validateFilters(filters, imageFilterKeys); err != nil {
+			return err
+		}
+
+		var opts []ocistore.PruneOpt
+		if all {
+			opts = append(opts, ocistore.WithPruneAll())
+		}
+		if len(filters) > 0 {
+			opts = append(opts, ocistore.WithPruneFilters(filters...))
+		}
+		if flags.Changed("keep") {
+			opts = append(opts, ocistore.WithPruneKeep(keep))
+		}
+		if flags.Changed("older-than") {
+			opts = append(opts, ocistore.WithPruneOlderThan(olderThan))
+		}
+
+		report, err := cs.Prune(append(opts, ocistore.WithPruneDryRun())...)
+		if err != nil {
+			return err
+		}
+
+		var tw = tabwriter.NewWriter(os.Stdout, 1, 4, 1, ' ', 0)
+		for _, img := range report.Images {
+			fmt.Fprintf(tw, "image\t%s\t%s\n", img.Name, img.Target.Digest)
+		}
+		for _, s := range report.Snapshots {
+			fmt.Fprintf(tw, "snapshot\t%s\t%s\n", s.Name, s.Kind)
+		}
+		if err = tw.Flush(); err != nil {
+			return err
+		}
+		printPruneSummary("Would remove", report)
+		if dryRun {
+			return nil
+		}
+
+		report, err = cs.Prune(opts...)
+		if err != nil {
+			return err
+		}
+		printPruneSummary("Removed", report)
+		return nil
+	},
+}
+
+func printPruneSummary(action string, report *ocistore.PruneReport) {
+	fmt.Printf(
+		"%s %d image(s), %d snapshot(s) and %d blob(s), %s released\n", action,
+		len(report.Images), len(report.Snapshots), len(report.GC.Content), humanSize(report.GC.Bytes),
+	)
+}
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+	pruneCmd.Flags().Bool("dry-run", false, "Reports what would be removed without removing anything")
+	pruneCmd.Flags().Bool("all", false, "Prune tagged images too, not only dangling ones")
+	pruneCmd.Flags().StringArray("filter", []string{}, "Only prune images matching containerd filters syntax, can be repeated")
+	pruneCmd.Flags().Int("keep", 0, "Number of newest images to keep out of the pruned ones")
+	pruneCmd.Flags().Duration("older-than", 0, "Only prune images created longer than this ago")
+}
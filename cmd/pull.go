@@ -30,13 +30,49 @@ var pullCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		flags := cmd.Flags()
 		unpack, _ := flags.GetBool("unpack")
+		platforms, _ := flags.GetStringSlice("platforms")
 		pOpts := []ocistore.PullOpt{}
 
+		ps, err := parsePlatforms(platforms)
+		if err != nil {
+			return err
+		}
+		if len(ps) > 0 {
+			pOpts = append(pOpts, ocistore.WithPullPlatforms(ps...))
+		}
+
 		if unpack {
 			pOpts = append(pOpts, ocistore.WithPullUnpack())
 		}
 
-		_, err := cs.Pull(args[0], pOpts...)
+		creds, err := credentialsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		if creds != nil {
+			pOpts = append(pOpts, ocistore.WithPullCredentials(*creds))
+		}
+
+		maxDownloads, _ := flags.GetInt("max-concurrent-downloads")
+		if maxDownloads > 0 {
+			pOpts = append(pOpts, ocistore.WithPullMaxConcurrentDownloads(maxDownloads))
+		}
+
+		retries, _ := flags.GetInt("retries")
+		backoff, _ := flags.GetDuration("retry-backoff")
+		pOpts = append(pOpts, ocistore.WithPullRetry(ocistore.RetryPolicy{Retries: retries, InitialBackoff: backoff}))
+
+		progress, _ := flags.GetString("progress")
+		display, finish, err := newProgressDisplay(progress)
+		if err != nil {
+			return err
+		}
+		if display != nil {
+			pOpts = append(pOpts, ocistore.WithPullProgress(display))
+		}
+
+		_, err = cs.Pull(args[0], pOpts...)
+		finish()
 
 		return err
 	},
@@ -46,4 +82,10 @@ func init() {
 	rootCmd.AddCommand(pullCmd)
 
 	pullCmd.Flags().Bool("unpack", false, "Unpacks the pulled image")
+	pullCmd.Flags().StringSlice("platforms", []string{}, "Platforms to pull, the image is unpacked for the first one (defaults to --platform)")
+	pullCmd.Flags().Int("max-concurrent-downloads", 3, "Maximum number of layers downloaded at once, 0 is unlimited")
+	pullCmd.Flags().Int("retries", 3, "Number of retries on transient registry errors, partial downloads are resumed")
+	pullCmd.Flags().Duration("retry-backoff", ocistore.DefaultRetryBackoff, "Delay before the first retry, doubled on every retry")
+	pullCmd.Flags().String("progress", progressAuto, "Progress output: auto, tty, plain, json or none (auto is tty on terminals and none otherwise)")
+	addCredentialsFlags(pullCmd)
 }
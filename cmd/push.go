@@ -0,0 +1,66 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/containerd/platforms"
+	"github.com/davidcassany/ocistore/pkg/ocistore"
+	"github.com/spf13/cobra"
+)
+
+// pushCmd represents the push command
+var pushCmd = &cobra.Command{
+	Use:   "push IMAGE_NAME [REMOTE_REF]",
+	Short: "Pushes an image to a registry",
+	Long: `Pushes the given image to its registry, or to REMOTE_REF if given. All platforms of the image
+are pushed unless a single one is selected`,
+	Args:    cobra.RangeArgs(1, 2),
+	PreRunE: initSharedCS,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		platform, _ := flags.GetString("single-platform")
+
+		var opts []ocistore.PushOpt
+		if len(args) > 1 {
+			opts = append(opts, ocistore.WithPushRemoteRef(args[1]))
+		}
+		if platform != "" {
+			p, err := platforms.Parse(platform)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, ocistore.WithPushPlatform(p))
+		}
+
+		creds, err := credentialsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		if creds != nil {
+			opts = append(opts, ocistore.WithPushCredentials(*creds))
+		}
+
+		return cs.Push(args[0], opts...)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pushCmd)
+
+	pushCmd.Flags().String("single-platform", "", "Only push the given platform of the image, e.g. 'linux/arm64'")
+	addCredentialsFlags(pushCmd)
+}
@@ -0,0 +1,94 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/davidcassany/ocistore/pkg/ocistore"
+	"github.com/spf13/cobra"
+)
+
+// recoverCmd represents the recover command
+var recoverCmd = &cobra.Command{
+	Use:   "recover",
+	Short: "Cleans up mounts and snapshots left behind by an interrupted run",
+	Long: `Cross-checks the recorded mounts, active snapshots and mount leases against the system mounts.
+Stale mount records and leases are removed, snapshots no longer mounted are kept or discarded
+according to the policy they were mounted with (see 'mount --policy') or the default policy`,
+	Args: cobra.ExactArgs(0),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			return initSharedCS(cmd, args)
+		}
+		return initCS(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		dryRun, _ := flags.GetBool("dry-run")
+		policy, _ := flags.GetString("default-policy")
+
+		var opts []ocistore.ReconcileOpt
+		if dryRun {
+			opts = append(opts, ocistore.WithReconcileDryRun())
+		}
+		if policy != "" {
+			opts = append(opts, ocistore.WithReconcileDefaultPolicy(policy))
+		}
+
+		report, err := cs.Reconcile(opts...)
+		if err != nil {
+			return err
+		}
+
+		var tw = tabwriter.NewWriter(os.Stdout, 1, 4, 1, ' ', 0)
+		for _, m := range report.StaleMounts {
+			fmt.Fprintf(tw, "mount\t%s\t%s\n", m.Target, m.Key)
+		}
+		for _, s := range report.Snapshots {
+			policy := s.Policy
+			if policy == "" {
+				policy = "<none>"
+			}
+			fmt.Fprintf(tw, "snapshot\t%s\t%s\t%s\n", s.Key, policy, s.Action)
+		}
+		for _, l := range report.StaleLeases {
+			fmt.Fprintf(tw, "lease\t%s\n", l)
+		}
+		if err = tw.Flush(); err != nil {
+			return err
+		}
+
+		var note string
+		if report.DryRun {
+			note = ", nothing changed on dry run"
+		}
+		fmt.Printf(
+			"Found %d stale mount(s), %d abandoned snapshot(s) and %d stale lease(s)%s\n",
+			len(report.StaleMounts), len(report.Snapshots), len(report.StaleLeases), note,
+		)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(recoverCmd)
+	recoverCmd.Flags().Bool("dry-run", false, "Reports the stale state without changing anything")
+	recoverCmd.Flags().String("default-policy", "", "Policy of abandoned snapshots mounted without policy: keep or discard (default only reports them)")
+}
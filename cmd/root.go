@@ -18,14 +18,18 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"os"
 
+	"github.com/containerd/platforms"
 	"github.com/davidcassany/ocistore/pkg/logger"
 	"github.com/davidcassany/ocistore/pkg/ocistore"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/spf13/cobra"
+	"golang.org/x/sys/unix"
 )
 
-var cs ocistore.OCIStore
+var cs *ocistore.OCIStore
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -46,11 +50,65 @@ func Execute() {
 }
 
 func initCS(cmd *cobra.Command, args []string) error {
+	return initStore(cmd)
+}
+
+// initSharedCS initiates the store as a shared reader, used by read-only commands so they
+// can run while another process holds the store
+func initSharedCS(cmd *cobra.Command, args []string) error {
+	return initStore(cmd, ocistore.WithSharedAccess())
+}
+
+func initStore(cmd *cobra.Command, extraOpts ...ocistore.StoreOpt) error {
 	flags := cmd.Flags()
 	root, _ := flags.GetString("root")
+	cfgFile, _ := flags.GetString("config")
 	llvl, _ := flags.GetString("loglevel")
 	debug, _ := flags.GetBool("debug")
+	namespace, _ := flags.GetString("namespace")
+	driver, _ := flags.GetString("driver")
+	platform, _ := flags.GetString("platform")
+	lockTimeout, _ := flags.GetDuration("lock-timeout")
+	readOnly, _ := flags.GetBool("read-only-store")
+
+	log := newLogger(debug, llvl)
+
+	// Flags only override the configuration file if they are explicitly set
+	opts := []ocistore.StoreOpt{ocistore.WithLockTimeout(lockTimeout)}
+	if cfgFile != "" {
+		opts = append(opts, ocistore.WithConfigFile(cfgFile))
+	}
+	if flags.Changed("namespace") {
+		opts = append(opts, ocistore.WithNamespace(namespace))
+	}
+	if flags.Changed("driver") {
+		opts = append(opts, ocistore.WithDriver(driver))
+	}
+	if readOnly || isReadOnlyFS(root) {
+		opts = append(opts, ocistore.WithReadOnly())
+	}
+	if platform != "" {
+		p, err := platforms.Parse(platform)
+		if err != nil {
+			return fmt.Errorf("invalid platform '%s': %w", platform, err)
+		}
+		opts = append(opts, ocistore.WithDefaultPlatform(p))
+	}
 
+	opts = append(opts, extraOpts...)
+	cs = ocistore.NewOCIStore(log, root, opts...)
+
+	// The log level of the configuration file only applies if not set by flags, the store is
+	// created again with the already loaded configuration and the new logger
+	if cfg := cs.Config(); cfg.LogLevel != "" && !debug && llvl == "" {
+		log = newLogger(false, cfg.LogLevel)
+		cs = ocistore.NewOCIStore(log, root, append(opts, ocistore.WithConfig(&cfg))...)
+	}
+	return cs.Init(context.Background())
+}
+
+// newLogger creates the CLI logger for the given level, invalid levels fall back to debug
+func newLogger(debug bool, llvl string) logger.Logger {
 	var log logger.Logger
 	var err error
 
@@ -60,32 +118,56 @@ func initCS(cmd *cobra.Command, args []string) error {
 		log, err = logger.NewLogger(llvl)
 		if err != nil {
 			log, _ = logger.NewLogger(logger.DebugLevel)
+			log.Warnf("could parse log level '%s', setting log to '%s' level", llvl, logger.DebugLevel)
 		}
-		log.Warnf("could parse log level '%s', setting log to '%s' level", llvl, logger.DebugLevel)
 	} else {
 		log, _ = logger.NewLogger(logger.InfoLevel)
 	}
+	return log
+}
 
-	cs = ocistore.NewOCIStore(log, root)
-	return cs.Init(context.Background())
+// parsePlatforms parses the given platform specifiers, e.g. 'linux/arm64'
+func parsePlatforms(specs []string) ([]ocispec.Platform, error) {
+	var ps []ocispec.Platform
+	for _, s := range specs {
+		p, err := platforms.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid platform '%s': %w", s, err)
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
+// isReadOnlyFS checks if the given path is on a read-only filesystem
+func isReadOnlyFS(path string) bool {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return false
+	}
+	return st.Flags&unix.ST_RDONLY != 0
 }
 
 func init() {
 	rootCmd.PersistentFlags().String("root", ocistore.DefaultRoot, "path for the containerd local store")
+	rootCmd.PersistentFlags().String("config", "", "path to the store configuration file (defaults to '<root>/config.toml')")
 	rootCmd.PersistentFlags().Bool("debug", false, "set log ouput to debug level")
 	rootCmd.PersistentFlags().String("loglevel", "", "set log ouput level")
+	rootCmd.PersistentFlags().String("namespace", ocistore.DefaultNamespace, "containerd namespace to operate in")
+	rootCmd.PersistentFlags().String("driver", ocistore.DefaultDriver, "snapshotter driver used to unpack and mount images (overlayfs, native or btrfs)")
+	rootCmd.PersistentFlags().String("platform", "", "default platform to select images for, e.g. 'linux/arm64' (defaults to host platform)")
+	rootCmd.PersistentFlags().Duration("lock-timeout", ocistore.DefaultLockTimeout, "time to wait for the store lock held by another process")
+	rootCmd.PersistentFlags().Bool("read-only-store", false, "open the store read-only, implied if root is on a read-only filesystem")
 	rootCmd.MarkFlagsMutuallyExclusive("debug", "loglevel")
 
 	cobra.OnFinalize(
 		func() {
-			if cs.IsInitiated() {
-				err := cs.GetClient().SnapshotService(cs.GetDriver()).Close()
+			if cs != nil && cs.IsInitiated() {
+				err := cs.Close()
 				if err != nil {
-					cs.Logger().Debugf("failed closing snapshotter: %v", err)
+					cs.Logger().Debugf("failed closing store: %v", err)
 				}
 			}
-		}, func() {
-			//TODO handle garbage collector
 		},
 	)
 }
@@ -17,8 +17,6 @@ limitations under the License.
 package cmd
 
 import (
-	"errors"
-
 	"github.com/spf13/cobra"
 )
 
@@ -38,10 +36,6 @@ var umountCmd = &cobra.Command{
 
 		log := cs.Logger()
 
-		if key == "" && (rmAllSnap || rmActiveSnap) {
-			return errors.New("snapshot key is required to delete snapshots")
-		}
-
 		if rmAllSnap {
 			removeSnap = -1
 		} else if rmActiveSnap {
@@ -60,7 +54,7 @@ var umountCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(umountCmd)
 
-	umountCmd.Flags().String("snapshot-key", "", "The key of the snapshot to delete")
+	umountCmd.Flags().String("snapshot-key", "", "The key of the snapshot to delete, defaults to the one recorded on mount")
 	umountCmd.Flags().Bool("remove-active", false, "Removes the unmounted active snapshot")
 	umountCmd.Flags().Bool("remove-all", false, "Removes all snapshots under active too, stops walking the chain if the target snapshot has childs")
 	umountCmd.MarkFlagsMutuallyExclusive("remove-active", "remove-all")
@@ -0,0 +1,242 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/distribution/reference"
+)
+
+// Credentials authenticate against a registry. Registries answering with a token challenge
+// exchange them for a bearer token. Credentials must never be logged.
+type Credentials struct {
+	Username string
+	// Password is the password of Username or, if Username is empty, an identity token
+	Password string
+	// RegistryToken is a bearer token sent as is to the registry
+	RegistryToken string
+}
+
+func (c Credentials) String() string {
+	if c.Username == "" {
+		return "Credentials{}"
+	}
+	return fmt.Sprintf("Credentials{Username: %s}", c.Username)
+}
+
+// CredentialsFunc returns the credentials of the given registry host, empty credentials result
+// in anonymous access
+type CredentialsFunc func(host string) (Credentials, error)
+
+// dockerHubHost is the name docker configuration files use for docker hub
+const dockerHubHost = "https://index.docker.io/v1/"
+
+// DockerCredentials returns the credentials stored in the given docker configuration file, or
+// in $DOCKER_CONFIG/config.json or ~/.docker/config.json if empty. Credential helpers,
+// 'docker-credential-<name>', are run as set by the 'credHelpers' and 'credsStore' keys. A
+// missing configuration file results in anonymous access.
+func DockerCredentials(configFile string) CredentialsFunc {
+	var (
+		once   sync.Once
+		cfg    *dockerConfig
+		cfgErr error
+		mu     sync.Mutex
+		cache  = map[string]Credentials{}
+	)
+	return func(host string) (Credentials, error) {
+		once.Do(func() {
+			cfg, cfgErr = loadDockerConfig(configFile)
+		})
+		if cfgErr != nil {
+			return Credentials{}, cfgErr
+		}
+
+		host = normalizeRegistryHost(host)
+		mu.Lock()
+		defer mu.Unlock()
+		if creds, ok := cache[host]; ok {
+			return creds, nil
+		}
+		creds, err := cfg.credentials(host)
+		if err != nil {
+			return Credentials{}, err
+		}
+		cache[host] = creds
+		return creds, nil
+	}
+}
+
+// StaticCredentials returns the given credentials for the registry of the given image reference
+// and falls back to the given function, if any, for any other registry
+func StaticCredentials(ref string, creds Credentials, fallback CredentialsFunc) (CredentialsFunc, error) {
+	named, err := reference.ParseDockerRef(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image reference '%s': %w", ref, err)
+	}
+	registry := normalizeRegistryHost(reference.Domain(named))
+	return func(host string) (Credentials, error) {
+		if normalizeRegistryHost(host) == registry {
+			return creds, nil
+		}
+		if fallback == nil {
+			return Credentials{}, nil
+		}
+		return fallback(host)
+	}, nil
+}
+
+// normalizeRegistryHost returns the given registry host without scheme nor path, docker hub
+// hosts are all normalized to 'docker.io'
+func normalizeRegistryHost(host string) string {
+	if _, h, ok := strings.Cut(host, "://"); ok {
+		host = h
+	}
+	host, _, _ = strings.Cut(host, "/")
+	switch host {
+	case "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+	return host
+}
+
+type dockerConfig struct {
+	Auths       map[string]dockerAuth `json:"auths"`
+	CredsStore  string                `json:"credsStore"`
+	CredHelpers map[string]string     `json:"credHelpers"`
+}
+
+type dockerAuth struct {
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+	RegistryToken string `json:"registrytoken"`
+}
+
+func loadDockerConfig(file string) (*dockerConfig, error) {
+	if file == "" {
+		dir := os.Getenv("DOCKER_CONFIG")
+		if dir == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return &dockerConfig{}, nil
+			}
+			dir = filepath.Join(home, ".docker")
+		}
+		file = filepath.Join(dir, "config.json")
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return &dockerConfig{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	cfg := &dockerConfig{}
+	if err = json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid docker configuration file '%s': %w", file, err)
+	}
+	return cfg, nil
+}
+
+func (cfg *dockerConfig) credentials(host string) (Credentials, error) {
+	helper := cfg.CredsStore
+	for h, name := range cfg.CredHelpers {
+		if normalizeRegistryHost(h) == host {
+			helper = name
+			break
+		}
+	}
+	if helper != "" {
+		creds, found, err := helperCredentials(helper, host)
+		if err != nil || found {
+			return creds, err
+		}
+	}
+
+	for h, auth := range cfg.Auths {
+		if normalizeRegistryHost(h) != host {
+			continue
+		}
+		creds := Credentials{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			RegistryToken: auth.RegistryToken,
+		}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return Credentials{}, fmt.Errorf("invalid auth of registry '%s' in docker configuration", host)
+			}
+			var ok bool
+			creds.Username, creds.Password, ok = strings.Cut(string(decoded), ":")
+			if !ok {
+				return Credentials{}, fmt.Errorf("invalid auth of registry '%s' in docker configuration", host)
+			}
+		}
+		if auth.IdentityToken != "" {
+			creds.Username, creds.Password = "", auth.IdentityToken
+		}
+		return creds, nil
+	}
+	return Credentials{}, nil
+}
+
+// helperCredentials runs the given docker credential helper. Errors never include the helper
+// output, as it might contain secrets.
+func helperCredentials(helper, host string) (Credentials, bool, error) {
+	serverURL := host
+	if host == "docker.io" {
+		serverURL = dockerHubHost
+	}
+
+	bin := "docker-credential-" + helper
+	cmd := exec.Command(bin, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stdout.String(), "credentials not found") {
+			return Credentials{}, false, nil
+		}
+		return Credentials{}, false, fmt.Errorf("credential helper '%s' failed for registry '%s': %w", bin, host, err)
+	}
+
+	var out struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return Credentials{}, false, fmt.Errorf("invalid output of credential helper '%s' for registry '%s'", bin, host)
+	}
+	// Identity tokens are stored with this placeholder user name
+	if out.Username == "<token>" {
+		return Credentials{Password: out.Secret}, true, nil
+	}
+	return Credentials{Username: out.Username, Password: out.Secret}, true, nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeRegistryHost(t *testing.T) {
+	for host, want := range map[string]string{
+		"docker.io":                   "docker.io",
+		"index.docker.io":             "docker.io",
+		"registry-1.docker.io":        "docker.io",
+		"https://index.docker.io/v1/": "docker.io",
+		"registry.local:5000":         "registry.local:5000",
+		"http://registry.local:5000":  "registry.local:5000",
+		"registry.local/v2/":          "registry.local",
+		"":                            "",
+	} {
+		if got := normalizeRegistryHost(host); got != want {
+			t.Errorf("expected '%s' to be normalized to '%s', got '%s'", host, want, got)
+		}
+	}
+}
+
+func TestDockerConfigCredentials(t *testing.T) {
+	// docker-credential-test knows the credentials of helper.local only
+	bin := t.TempDir()
+	helper := `#!/bin/sh
+read host
+case "$host" in
+  helper.local) echo '{"Username":"helper","Secret":"helper-secret"}' ;;
+  token.helper.local) echo '{"Username":"<token>","Secret":"helper-token"}' ;;
+  broken.local) echo 'not json' ;;
+  *) echo 'credentials not found in native keychain'; exit 1 ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(bin, "docker-credential-test"), []byte(helper), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	auth := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	config := `{
+  "auths": {
+    "https://index.docker.io/v1/": {"auth": "` + auth("hub:hub-secret") + `"},
+    "registry.local:5000": {"username": "user", "password": "secret"},
+    "token.local": {"auth": "` + auth("user:secret") + `", "identitytoken": "id-token"},
+    "bearer.local": {"registrytoken": "bearer-token"},
+    "invalid.local": {"auth": "` + auth("no-colon") + `"},
+    "fallback.local": {"username": "fallback", "password": "secret"}
+  },
+  "credHelpers": {
+    "helper.local": "test",
+    "token.helper.local": "test",
+    "broken.local": "test",
+    "fallback.local": "test"
+  }
+}`
+	file := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(file, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	creds := DockerCredentials(file)
+
+	for host, want := range map[string]Credentials{
+		"docker.io":            {Username: "hub", Password: "hub-secret"},
+		"registry-1.docker.io": {Username: "hub", Password: "hub-secret"},
+		"registry.local:5000":  {Username: "user", Password: "secret"},
+		"token.local":          {Password: "id-token"},
+		"bearer.local":         {RegistryToken: "bearer-token"},
+		"helper.local":         {Username: "helper", Password: "helper-secret"},
+		"token.helper.local":   {Password: "helper-token"},
+		"fallback.local":       {Username: "fallback", Password: "secret"},
+		"unknown.local":        {},
+	} {
+		got, err := creds(host)
+		if err != nil {
+			t.Errorf("failed to get credentials of '%s': %v", host, err)
+		} else if got != want {
+			t.Errorf("expected credentials %v of '%s', got %v", want, host, got)
+		}
+	}
+
+	for _, host := range []string{"invalid.local", "broken.local"} {
+		_, err := creds(host)
+		if err == nil {
+			t.Errorf("expected an error getting credentials of '%s'", host)
+		} else if strings.Contains(err.Error(), "secret") || strings.Contains(err.Error(), "not json") {
+			t.Errorf("error leaks credentials: %v", err)
+		}
+	}
+
+	// Missing configuration files result in anonymous access
+	got, err := DockerCredentials(filepath.Join(t.TempDir(), "missing.json"))("docker.io")
+	if err != nil || got != (Credentials{}) {
+		t.Errorf("expected anonymous access without configuration file, got %v, %v", got, err)
+	}
+}
+
+func TestStaticCredentials(t *testing.T) {
+	fallback := func(host string) (Credentials, error) {
+		return Credentials{Username: "fallback"}, nil
+	}
+	creds, err := StaticCredentials("alpine:latest", Credentials{Username: "user", Password: "secret"}, fallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := creds("registry-1.docker.io"); got.Username != "user" {
+		t.Errorf("expected static credentials for docker hub, got %v", got)
+	}
+	if got, _ := creds("registry.local"); got.Username != "fallback" {
+		t.Errorf("expected fallback credentials for other registries, got %v", got)
+	}
+	if s := (Credentials{Username: "user", Password: "secret"}).String(); strings.Contains(s, "secret") {
+		t.Errorf("credentials string leaks the password: %s", s)
+	}
+	if _, err = StaticCredentials("Invalid:Ref", Credentials{}, nil); err == nil {
+		t.Error("expected an error for an invalid reference")
+	}
+}
@@ -0,0 +1,46 @@
+//go:build linux && !no_btrfs && cgo
+
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/containerd/v2/plugins/snapshots/btrfs"
+	"golang.org/x/sys/unix"
+)
+
+// newBtrfsSnapshotter creates a btrfs snapshotter on the given root, image layers are stored
+// as btrfs subvolumes and snapshots. Root is required to be on a btrfs filesystem.
+func newBtrfsSnapshotter(root string) (snapshots.Snapshotter, error) {
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, err
+	}
+
+	var st unix.Statfs_t
+	if err := unix.Statfs(root, &st); err != nil {
+		return nil, fmt.Errorf("failed to check filesystem type of '%s': %w", root, err)
+	}
+	if st.Type != unix.BTRFS_SUPER_MAGIC {
+		return nil, fmt.Errorf("'%s' driver requires '%s' to be on a btrfs filesystem", BtrfsDriver, root)
+	}
+
+	return btrfs.NewSnapshotter(root)
+}
@@ -21,9 +21,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"runtime"
 	"time"
 
 	"github.com/containerd/containerd/v2/client"
@@ -34,6 +32,7 @@ import (
 	"github.com/containerd/containerd/v2/core/snapshots"
 	"github.com/containerd/containerd/v2/pkg/rootfs"
 	"github.com/containerd/errdefs"
+	"github.com/containerd/platforms"
 	"github.com/opencontainers/go-digest"
 	"github.com/opencontainers/image-spec/identity"
 	"github.com/opencontainers/image-spec/specs-go"
@@ -61,13 +60,15 @@ type ImgOpts struct {
 
 type CommitImgOpts struct {
 	ApplyCommitOpts
-	iOpts ImgOpts
-	dOpts []diff.Opt
+	iOpts    ImgOpts
+	dOpts    []diff.Opt
+	platform *ocispec.Platform
 }
 
 type ApplyCommitOpts struct {
-	sOpts []snapshots.Opt
-	aOpts []diff.ApplyOpt
+	sOpts    []snapshots.Opt
+	aOpts    []diff.ApplyOpt
+	platform platforms.MatchComparer
 }
 
 type CommitImgOpt func(*CommitImgOpts) error
@@ -87,6 +88,15 @@ func WithApplyOpts(opts ...diff.ApplyOpt) ApplyCommitOpt {
 	}
 }
 
+// WithUnpackPlatform sets the platform to unpack, defaults to the platform the image was selected
+// for. Unpacking only applies the image layers, so images of any platform can be unpacked.
+func WithUnpackPlatform(platform ocispec.Platform) ApplyCommitOpt {
+	return func(co *ApplyCommitOpts) error {
+		co.platform = platforms.OnlyStrict(platform)
+		return nil
+	}
+}
+
 func WithImgApplyCommitOpts(opts ...ApplyCommitOpt) CommitImgOpt {
 	return func(co *CommitImgOpts) error {
 		for _, o := range opts {
@@ -106,10 +116,21 @@ func WithImgCommitOpts(iOpts ImgOpts) CommitImgOpt {
 	}
 }
 
+// WithCommitPlatform sets the platform of the committed image. It defaults to the platform of the
+// base image or to the store default platform for images committed from scratch.
+func WithCommitPlatform(platform ocispec.Platform) CommitImgOpt {
+	return func(co *CommitImgOpts) error {
+		co.platform = &platform
+		return nil
+	}
+}
+
 func (c *OCIStore) Commit(snapshotKey string, opts ...CommitImgOpt) (_ client.Image, retErr error) {
-	if !c.IsInitiated() {
-		return nil, errors.New(missInitErrMsg)
+	release, err := c.startWriteOp()
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
 	cOpt := &CommitImgOpts{
 		ApplyCommitOpts: ApplyCommitOpts{
@@ -131,7 +152,7 @@ func (c *OCIStore) Commit(snapshotKey string, opts ...CommitImgOpt) (_ client.Im
 
 	// TODO which is the dirty data to clean?
 	// Don't gc me and clean the dirty data after 1 hour!
-	ctx, done, err := c.cli.WithLease(c.ctx, leases.WithRandomID(), leases.WithExpiration(1*time.Hour))
+	ctx, done, err := c.withLease(c.ctx, leases.WithRandomID(), leases.WithExpiration(c.commitLease))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create lease for commit: %w", err)
 	}
@@ -150,11 +171,17 @@ func (c *OCIStore) Commit(snapshotKey string, opts ...CommitImgOpt) (_ client.Im
 	var baseImgConfig ocispec.Image
 	var baseMfst *ocispec.Manifest
 
+	matcher := c.platform
+	if cOpt.platform != nil {
+		matcher = platforms.OnlyStrict(*cOpt.platform)
+	}
+
 	if imgRef, ok := info.Labels[LabelSnapshotImgRef]; ok {
-		baseImage, err := c.cli.GetImage(ctx, imgRef)
+		img, err := c.cli.ImageService().Get(ctx, imgRef)
 		if err != nil {
 			return nil, err
 		}
+		baseImage := client.NewImageWithPlatform(c.cli, img, matcher)
 
 		baseImgConfig, _, err = ReadImageConfig(ctx, baseImage)
 		if err != nil {
@@ -174,14 +201,15 @@ func (c *OCIStore) Commit(snapshotKey string, opts ...CommitImgOpt) (_ client.Im
 		return nil, fmt.Errorf("failed to export layer: %w", err)
 	}
 
-	imageConfig, err := generateCommitImageConfig(baseImgConfig, diffID, &cOpt.iOpts)
+	platform := c.commitPlatform(baseImgConfig, cOpt.platform)
+	imageConfig, err := generateCommitImageConfig(baseImgConfig, diffID, platform, &cOpt.iOpts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate commit image config: %w", err)
 	}
 
 	rootfsID := identity.ChainID(imageConfig.RootFS.DiffIDs).String()
-	if err := applyDiffLayer(ctx, rootfsID, snapshotKey, sn, differ, diffLayerDesc); err != nil {
-		return nil, fmt.Errorf("failed to apply diff: %w", err)
+	if err := commitSnapshot(ctx, rootfsID, snapshotKey, sn); err != nil {
+		return nil, fmt.Errorf("failed to commit snapshot: %w", err)
 	}
 
 	// TODO shall we keep the configDigest for something?
@@ -214,8 +242,8 @@ func (c *OCIStore) Commit(snapshotKey string, opts ...CommitImgOpt) (_ client.Im
 	}
 
 	// unpack the image to snapshotter
-	cimg := client.NewImage(c.cli, img)
-	if err := c.unpack(ctx, cimg); err != nil {
+	cimg := client.NewImageWithPlatform(c.cli, img, platforms.OnlyStrict(platform))
+	if err := c.unpack(ctx, cimg, WithUnpackPlatform(platform)); err != nil {
 		return nil, err
 	}
 
@@ -252,8 +280,25 @@ func createDiff(ctx context.Context, name string, sn snapshots.Snapshotter, cs c
 	}, diffID, nil
 }
 
+// commitPlatform returns the platform of a committed image: the requested one, the one of
+// the base image or the store default platform, in this order
+func (c *OCIStore) commitPlatform(baseConfig ocispec.Image, platform *ocispec.Platform) ocispec.Platform {
+	if platform != nil {
+		return platforms.Normalize(*platform)
+	}
+	if baseConfig.Architecture != "" && baseConfig.OS != "" {
+		return platforms.Normalize(baseConfig.Platform)
+	}
+	if baseConfig.Architecture != "" || baseConfig.OS != "" {
+		c.log.Warnf("base image platform is incomplete, committing for '%s'", platforms.Format(c.platformSpec))
+	} else {
+		c.log.Debugf("no base image platform, committing for '%s'", platforms.Format(c.platformSpec))
+	}
+	return c.platformSpec
+}
+
 // generateCommitImageConfig returns commit oci image config based on the container's image.
-func generateCommitImageConfig(baseConfig ocispec.Image, diffID digest.Digest, opts *ImgOpts) (ocispec.Image, error) {
+func generateCommitImageConfig(baseConfig ocispec.Image, diffID digest.Digest, platform ocispec.Platform, opts *ImgOpts) (ocispec.Image, error) {
 	// TODO(fuweid): support updating the USER/ENV/... fields?
 	if opts.Changes.CMD != nil {
 		baseConfig.Config.Cmd = opts.Changes.CMD
@@ -267,22 +312,9 @@ func generateCommitImageConfig(baseConfig ocispec.Image, diffID digest.Digest, o
 
 	createdBy := ""
 	createdTime := time.Now()
-	arch := baseConfig.Architecture
-	if arch == "" {
-		arch = runtime.GOARCH
-		//TODO log warning assuming ARCH
-	}
-	os := baseConfig.OS
-	if os == "" {
-		os = runtime.GOOS
-		// TODO log warning assuming OS
-	}
 
 	return ocispec.Image{
-		Platform: ocispec.Platform{
-			Architecture: arch,
-			OS:           os,
-		},
+		Platform: platform,
 
 		Created: &createdTime,
 		Author:  opts.Author,
@@ -369,19 +401,12 @@ func writeContentsForImage(ctx context.Context, cs content.Store, snName string,
 	return newMfstDesc, configDesc.Digest, nil
 }
 
-// applyDiffLayer will apply diff layer content created by createDiff into the snapshotter.
-func applyDiffLayer(ctx context.Context, name string, snapshotKey string, sn snapshots.Snapshotter, differ diff.Applier, diffDesc ocispec.Descriptor) (retErr error) {
-	mounts, err := sn.Mounts(ctx, snapshotKey)
-	if err != nil {
-		return err
-	}
-
-	if _, err = differ.Apply(ctx, diffDesc, mounts); err != nil {
-		return err
-	}
-
+// commitSnapshot commits the active snapshot as the committed snapshot of the new image layer.
+// The active snapshot already holds the changes captured in the diff, so there is no need to apply
+// the diff again, this keeps the commit independent of the driver's on-disk layout.
+func commitSnapshot(ctx context.Context, name string, snapshotKey string, sn snapshots.Snapshotter) error {
 	// Label added here is just to be consistent with unpacked images, I don't know the motivation of this label
-	if err = sn.Commit(ctx, name, snapshotKey, snapshots.WithLabels(map[string]string{
+	if err := sn.Commit(ctx, name, snapshotKey, snapshots.WithLabels(map[string]string{
 		"containerd.io/snapshot.ref": name,
 	})); err != nil {
 		if errdefs.IsAlreadyExists(err) {
@@ -0,0 +1,302 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/remotes/docker"
+	"github.com/containerd/containerd/v2/core/remotes/docker/config"
+	"github.com/containerd/containerd/v2/plugins/snapshots/overlay"
+	"github.com/containerd/platforms"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// The store configuration file is a TOML document, all keys are optional and unset keys keep
+// the store defaults:
+//
+//	# containerd namespace to operate in
+//	namespace = "elemental-system"
+//	# default platform to select images for, defaults to the host platform
+//	platform = "linux/amd64"
+//	# log level of the ocistore CLI: trace, debug, info, warn or error
+//	log_level = "info"
+//
+//	[driver]
+//	# snapshotter driver: overlayfs, native or btrfs
+//	name = "overlayfs"
+//
+//	[driver.overlayfs]
+//	# remove snapshot data asynchronously on cleanup
+//	async_remove = false
+//	# label snapshots with their upperdir path
+//	upperdir_label = false
+//	# extra options passed to every overlay mount
+//	mount_options = []
+//
+//	[leases]
+//	# how long mounts and commits are protected from garbage collection
+//	mount = "24h"
+//	commit = "1h"
+//
+//	[registry]
+//	# registry hosts reached over plain HTTP, localhost is always allowed
+//	plain_http = ["localhost:5000"]
+//	# registry hosts whose TLS certificate is not verified
+//	skip_verify = []
+//	# docker configuration file holding registry credentials, defaults to
+//	# $DOCKER_CONFIG/config.json or ~/.docker/config.json
+//	auth_file = ""
+//	# directory of per host configuration files, <host>/hosts.toml, defining mirrors, CA
+//	# certificates and client certificates, defaults to the certs.d folder of the store root
+//	config_path = ""
+//
+//	[gc]
+//	# collect unreferenced content and snapshots after deleting images or removing snapshots
+//	auto = false
+
+const (
+	ConfigFile = "config.toml"
+
+	DefaultMountLease  = 24 * time.Hour
+	DefaultCommitLease = 1 * time.Hour
+)
+
+// Config is the declarative configuration of a store, see LoadConfig
+type Config struct {
+	Namespace string         `toml:"namespace"`
+	Platform  string         `toml:"platform"`
+	LogLevel  string         `toml:"log_level"`
+	Driver    DriverConfig   `toml:"driver"`
+	Leases    LeasesConfig   `toml:"leases"`
+	Registry  RegistryConfig `toml:"registry"`
+	GC        GCPolicy       `toml:"gc"`
+}
+
+// DriverConfig selects the snapshotter driver and its options
+type DriverConfig struct {
+	Name    string        `toml:"name"`
+	Overlay OverlayConfig `toml:"overlayfs"`
+}
+
+// OverlayConfig holds the options of the overlayfs driver
+type OverlayConfig struct {
+	AsyncRemove   bool     `toml:"async_remove"`
+	UpperdirLabel bool     `toml:"upperdir_label"`
+	MountOptions  []string `toml:"mount_options"`
+}
+
+// LeasesConfig sets the expiration of the leases taken by mount and commit operations
+type LeasesConfig struct {
+	Mount  Duration `toml:"mount"`
+	Commit Duration `toml:"commit"`
+}
+
+// RegistryConfig holds the settings used to reach remote registries
+type RegistryConfig struct {
+	PlainHTTP  []string `toml:"plain_http"`
+	SkipVerify []string `toml:"skip_verify"`
+	AuthFile   string   `toml:"auth_file"`
+	ConfigPath string   `toml:"config_path"`
+}
+
+// GCPolicy defines when garbage collection runs implicitly
+type GCPolicy struct {
+	Auto bool `toml:"auto"`
+}
+
+// Duration is a time.Duration expressed as a string in configuration files, e.g. "1h30m"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// LoadConfig reads the store configuration from the given TOML file. Unknown keys are
+// refused to catch typos early.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg := &Config{}
+	dec := toml.NewDecoder(f).DisallowUnknownFields()
+	if err = dec.Decode(cfg); err != nil {
+		var strictErr *toml.StrictMissingError
+		if errors.As(err, &strictErr) {
+			return nil, fmt.Errorf("unknown keys in config file '%s':\n%s", path, strictErr.String())
+		}
+		return nil, fmt.Errorf("failed to parse config file '%s': %w", path, err)
+	}
+	return cfg, nil
+}
+
+// WithConfig configures the store from the given configuration. The configuration is applied
+// before any other option, so options always take precedence over it. Setting a configuration
+// prevents loading the config file from the store root.
+func WithConfig(cfg *Config) StoreOpt {
+	return func(c *OCIStore) {
+		c.config = cfg
+	}
+}
+
+// WithConfigFile sets the configuration file to load instead of the one in the store root,
+// it is handled as WithConfig
+func WithConfigFile(path string) StoreOpt {
+	return func(c *OCIStore) {
+		c.configFile = path
+	}
+}
+
+// WithOverlayOpts sets the options used to create the overlayfs driver
+func WithOverlayOpts(opts ...overlay.Opt) StoreOpt {
+	return func(c *OCIStore) {
+		c.overlayOpts = opts
+	}
+}
+
+// WithLeaseExpirations sets how long mounts and commits are protected from garbage collection
+func WithLeaseExpirations(mount, commit time.Duration) StoreOpt {
+	return func(c *OCIStore) {
+		c.mountLease = mount
+		c.commitLease = commit
+	}
+}
+
+// WithRegistryConfig sets the settings used to reach remote registries
+func WithRegistryConfig(reg RegistryConfig) StoreOpt {
+	return func(c *OCIStore) {
+		c.registry = reg
+	}
+}
+
+// WithCredentials sets the function looking up registry credentials, by default they are read
+// from the docker configuration file, see DockerCredentials
+func WithCredentials(creds CredentialsFunc) StoreOpt {
+	return func(c *OCIStore) {
+		c.credentials = creds
+	}
+}
+
+// WithGCPolicy sets when garbage collection runs implicitly
+func WithGCPolicy(policy GCPolicy) StoreOpt {
+	return func(c *OCIStore) {
+		c.gcPolicy = policy
+	}
+}
+
+// apply sets the values defined in the configuration into the given store
+func (cfg *Config) apply(c *OCIStore) error {
+	if cfg.Namespace != "" {
+		c.namespace = cfg.Namespace
+	}
+	if cfg.Platform != "" {
+		p, err := platforms.Parse(cfg.Platform)
+		if err != nil {
+			return fmt.Errorf("invalid platform '%s': %w", cfg.Platform, err)
+		}
+		WithDefaultPlatform(p)(c)
+	}
+	if cfg.Driver.Name != "" {
+		c.driver = cfg.Driver.Name
+	}
+
+	ovl := cfg.Driver.Overlay
+	if ovl.AsyncRemove {
+		c.overlayOpts = append(c.overlayOpts, overlay.AsynchronousRemove)
+	}
+	if ovl.UpperdirLabel {
+		c.overlayOpts = append(c.overlayOpts, overlay.WithUpperdirLabel)
+	}
+	if len(ovl.MountOptions) > 0 {
+		c.overlayOpts = append(c.overlayOpts, overlay.WithMountOptions(ovl.MountOptions))
+	}
+
+	if cfg.Leases.Mount > 0 {
+		c.mountLease = time.Duration(cfg.Leases.Mount)
+	}
+	if cfg.Leases.Commit > 0 {
+		c.commitLease = time.Duration(cfg.Leases.Commit)
+	}
+
+	c.registry = cfg.Registry
+	c.gcPolicy = cfg.GC
+	return nil
+}
+
+// registryHosts returns the registry hosts configuration for the configured registry settings
+// and the hosts.toml files found in hostsDir, authenticating with the given credentials
+func (r RegistryConfig) registryHosts(ctx context.Context, hostsDir string, creds CredentialsFunc) docker.RegistryHosts {
+	authCreds := func(host string) (string, string, error) {
+		c, err := creds(host)
+		return c.Username, c.Password, err
+	}
+
+	return func(host string) ([]docker.RegistryHost, error) {
+		opts := config.HostOptions{
+			HostDir:     config.HostDirFromRoot(hostsDir),
+			Credentials: authCreds,
+		}
+		// Settings below only apply to hosts not configured by a hosts.toml file
+		if slices.Contains(r.PlainHTTP, host) {
+			opts.DefaultScheme = "http"
+		}
+		if slices.Contains(r.SkipVerify, host) {
+			opts.DefaultTLS = &tls.Config{InsecureSkipVerify: true}
+		}
+
+		hosts, err := config.ConfigureHosts(ctx, opts)(host)
+		if err != nil {
+			return nil, err
+		}
+
+		// Registry tokens are looked up per host as the authorizer does for other credentials,
+		// so mirrors never get the token of the upstream registry
+		for i := range hosts {
+			c, err := creds(hosts[i].Host)
+			if err != nil {
+				return nil, err
+			}
+			if c.RegistryToken == "" {
+				continue
+			}
+			if hosts[i].Header == nil {
+				hosts[i].Header = http.Header{}
+			}
+			hosts[i].Header.Set("Authorization", "Bearer "+c.RegistryToken)
+		}
+		return hosts, nil
+	}
+}
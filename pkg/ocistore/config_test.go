@@ -0,0 +1,218 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigFromRoot(t *testing.T) {
+	root := t.TempDir()
+	writeConfig(t, filepath.Join(root, ConfigFile), `
+namespace = "from-root"
+log_level = "debug"
+
+[leases]
+mount = "2h"
+`)
+
+	cs := NewOCIStore(testLogger(t), root)
+	if cs.namespace != "from-root" || cs.mountLease != 2*time.Hour {
+		t.Errorf("configuration not applied: namespace '%s', mount lease %s", cs.namespace, cs.mountLease)
+	}
+	if lvl := cs.Config().LogLevel; lvl != "debug" {
+		t.Errorf("expected resolved log level 'debug', got '%s'", lvl)
+	}
+
+	// Options take precedence over the configuration
+	cs = NewOCIStore(testLogger(t), root, WithNamespace("from-opts"))
+	if cs.namespace != "from-opts" {
+		t.Errorf("expected namespace set by options, got '%s'", cs.namespace)
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	root := t.TempDir()
+	writeConfig(t, filepath.Join(root, ConfigFile), `log_level = "debug"`)
+	file := filepath.Join(t.TempDir(), "custom.toml")
+	writeConfig(t, file, `
+namespace = "custom"
+log_level = "warn"
+`)
+
+	// An explicit configuration file replaces the one in root
+	cs := NewOCIStore(testLogger(t), root, WithConfigFile(file))
+	if cfg := cs.Config(); cfg.Namespace != "custom" || cfg.LogLevel != "warn" {
+		t.Errorf("unexpected resolved configuration: %+v", cfg)
+	}
+
+	// The resolved configuration can be reused without loading the file again
+	cfg := cs.Config()
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	cs = NewOCIStore(testLogger(t), root, WithConfigFile(file), WithConfig(&cfg))
+	if cs.namespace != "custom" {
+		t.Errorf("expected namespace from the given configuration, got '%s'", cs.namespace)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	root := t.TempDir()
+
+	// Missing configuration in root is fine
+	cs := NewOCIStore(testLogger(t), root)
+	if cfg := cs.Config(); cfg.LogLevel != "" || cfg.Namespace != "" {
+		t.Errorf("expected an empty configuration, got %+v", cfg)
+	}
+
+	// A missing explicit configuration file fails on Init
+	cs = NewOCIStore(testLogger(t), root, WithConfigFile(filepath.Join(root, "missing.toml")))
+	if err := cs.Init(context.Background()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a missing file error, got: %v", err)
+	}
+
+	writeConfig(t, filepath.Join(root, ConfigFile), `namepsace = "typo"`)
+	cs = NewOCIStore(testLogger(t), root)
+	err := cs.Init(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "namepsace") {
+		t.Errorf("expected an unknown key error, got: %v", err)
+	}
+}
+
+func TestRegistryHostsTLS(t *testing.T) {
+	reg := newTestRegistry(t, true)
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	pemCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: reg.Certificate().Raw})
+	if err := os.WriteFile(ca, pemCert, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// registry.test is served by the test registry as configured in its hosts.toml file
+	const remote = "registry.test/test/img:latest"
+	writeHosts := func(dir, settings string) {
+		t.Helper()
+		hostDir := filepath.Join(dir, "registry.test")
+		if err := os.MkdirAll(hostDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeConfig(t, filepath.Join(hostDir, "hosts.toml"), "server = \""+reg.URL+"\"\n"+settings)
+	}
+
+	for name, tc := range map[string]struct {
+		settings string
+		fail     bool
+	}{
+		"untrusted":   {"", true},
+		"ca":          {"ca = \"" + ca + "\"\n", false},
+		"skip verify": {"skip_verify = true\n", false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			hostsDir := t.TempDir()
+			writeHosts(hostsDir, tc.settings)
+			cs := newTestStore(t, t.TempDir(), WithRegistryConfig(RegistryConfig{ConfigPath: hostsDir}))
+			importTestImage(t, cs, "test/img:latest", testLayer{"file": name})
+
+			err := cs.Push("test/img:latest", WithPushRemoteRef(remote))
+			if tc.fail {
+				if err == nil || !strings.Contains(err.Error(), "certificate") {
+					t.Errorf("expected a certificate error, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to push: %v", err)
+			}
+		})
+	}
+
+	// hosts.toml files are read from the store root by default
+	root := t.TempDir()
+	writeHosts(filepath.Join(root, certsDir), "ca = \""+ca+"\"\n")
+	cs := newTestStore(t, root)
+	if _, err := cs.Pull(remote); err != nil {
+		t.Fatalf("failed to pull: %v", err)
+	}
+}
+
+func TestRegistryTokenMirrors(t *testing.T) {
+	upstream := newTestRegistry(t, false)
+	mirror := newTestRegistry(t, false)
+	pushTestImage(t, upstream, "test/upstream:latest", testLayer{"file": "upstream"})
+	pushTestImage(t, mirror, "test/mirror:latest", testLayer{"file": "mirror"})
+
+	hostsDir := t.TempDir()
+	hostDir := filepath.Join(hostsDir, upstream.host())
+	if err := os.MkdirAll(hostDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeConfig(t, filepath.Join(hostDir, "hosts.toml"), "server = \""+upstream.URL+"\"\n\n"+
+		"[host.\""+mirror.URL+"\"]\n  capabilities = [\"pull\", \"resolve\"]\n")
+
+	creds := func(host string) (Credentials, error) {
+		if host == upstream.host() {
+			return Credentials{RegistryToken: "upstream-token"}, nil
+		}
+		return Credentials{}, nil
+	}
+	cs := newTestStore(t, t.TempDir(), WithRegistryConfig(RegistryConfig{ConfigPath: hostsDir}), WithCredentials(creds))
+
+	// Images missing in the mirror fall back to the upstream registry
+	for _, name := range []string{"test/mirror:latest", "test/upstream:latest"} {
+		if _, err := cs.Pull(upstream.host() + "/" + name); err != nil {
+			t.Fatalf("failed to pull '%s': %v", name, err)
+		}
+	}
+
+	authHeaders := func(reg *testRegistry) []string {
+		reg.mu.Lock()
+		defer reg.mu.Unlock()
+		var headers []string
+		for _, r := range reg.requests {
+			headers = append(headers, r.Header.Get("Authorization"))
+		}
+		return headers
+	}
+	// Requests pushing the test images are recorded too, none of them authenticated
+	mirrorHeaders := authHeaders(mirror)
+	if len(mirrorHeaders) == 0 {
+		t.Fatal("expected requests to the mirror")
+	}
+	for _, h := range mirrorHeaders {
+		if h != "" {
+			t.Errorf("expected no authorization sent to the mirror, got '%s'", h)
+		}
+	}
+	if !slices.Contains(authHeaders(upstream), "Bearer upstream-token") {
+		t.Error("expected the registry token sent to the upstream registry")
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"context"
+	"sort"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/errdefs"
+	"github.com/opencontainers/go-digest"
+)
+
+// DiskUsage is the disk space used by the store namespace, all sizes are in bytes
+type DiskUsage struct {
+	// ContentSize is the size of all content blobs
+	ContentSize int64
+	// SnapshotsSize is the size of all snapshots
+	SnapshotsSize int64
+	Images        []ImageUsage
+	Snapshots     []SnapshotUsage
+	// Reclaimable is the space the garbage collector would release across all namespaces
+	Reclaimable int64
+}
+
+// ImageUsage is the disk space used by an image. Shared is the part of the content and unpacked
+// size also used by other images, Exclusive is the space released if the image is deleted.
+type ImageUsage struct {
+	Name         string
+	Digest       digest.Digest
+	ContentSize  int64
+	UnpackedSize int64
+	Shared       int64
+	Exclusive    int64
+}
+
+// SnapshotUsage is the disk space used by an active snapshot or view
+type SnapshotUsage struct {
+	Key    string
+	Kind   snapshots.Kind
+	Parent string
+	Size   int64
+	Inodes int64
+}
+
+// DiskUsage reports the disk space used by the content, images and active snapshots of the store
+// namespace
+func (c *OCIStore) DiskUsage() (*DiskUsage, error) {
+	release, err := c.startOp()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	du, err := c.diskUsage(c.ctx)
+	if err != nil {
+		c.log.Errorf("failed to compute disk usage: %v", err)
+		return nil, err
+	}
+	return du, nil
+}
+
+func (c *OCIStore) diskUsage(ctx context.Context) (*DiskUsage, error) {
+	du := &DiskUsage{}
+
+	err := c.cli.ContentStore().Walk(ctx, func(info content.Info) error {
+		du.ContentSize += info.Size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sn := c.cli.SnapshotService(c.driver)
+	snapSizes := map[string]int64{}
+	infos, err := listSnapshots(ctx, sn)
+	if err != nil && !errdefs.IsNotFound(err) {
+		return nil, err
+	}
+	for _, info := range infos {
+		usage, err := sn.Usage(ctx, info.Name)
+		if err != nil {
+			return nil, err
+		}
+		snapSizes[info.Name] = usage.Size
+		du.SnapshotsSize += usage.Size
+		if info.Kind != snapshots.KindCommitted {
+			du.Snapshots = append(du.Snapshots, SnapshotUsage{
+				Key: info.Name, Kind: info.Kind, Parent: info.Parent, Size: usage.Size, Inodes: usage.Inodes,
+			})
+		}
+	}
+
+	imgs, err := c.cli.ImageService().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	type resources struct {
+		blobs map[digest.Digest]int64
+		snaps map[string]bool
+	}
+	imgResources := make([]resources, len(imgs))
+	blobRefs := map[digest.Digest]int{}
+	snapRefs := map[string]int{}
+	for i, img := range imgs {
+		blobs, snaps, err := c.imageResources(ctx, sn, img)
+		if err != nil {
+			return nil, err
+		}
+		imgResources[i] = resources{blobs: blobs, snaps: snaps}
+		for d := range blobs {
+			blobRefs[d]++
+		}
+		for key := range snaps {
+			snapRefs[key]++
+		}
+	}
+
+	for i, img := range imgs {
+		iu := ImageUsage{Name: img.Name, Digest: img.Target.Digest}
+		for d, size := range imgResources[i].blobs {
+			iu.ContentSize += size
+			if blobRefs[d] > 1 {
+				iu.Shared += size
+			} else {
+				iu.Exclusive += size
+			}
+		}
+		for key := range imgResources[i].snaps {
+			size := snapSizes[key]
+			iu.UnpackedSize += size
+			if snapRefs[key] > 1 {
+				iu.Shared += size
+			} else {
+				iu.Exclusive += size
+			}
+		}
+		du.Images = append(du.Images, iu)
+	}
+	sort.Slice(du.Images, func(i, j int) bool { return du.Images[i].Name < du.Images[j].Name })
+
+	report, err := c.garbageCollect(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	du.Reclaimable = report.Bytes
+
+	return du, nil
+}
@@ -0,0 +1,144 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/snapshots"
+)
+
+func TestDiskUsage(t *testing.T) {
+	cs := newTestStore(t, t.TempDir())
+	base := testLayer{"base": strings.Repeat("base", 4096)}
+	for _, name := range []string{"test/a:latest", "test/b:latest"} {
+		importTestImage(t, cs, name, base, testLayer{"name": strings.Repeat(name, 512)})
+		img, err := cs.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = cs.Unpack(img); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A view on top of image a, leased so it is not collected
+	ctx, done, err := cs.withLease(cs.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer done(ctx)
+	details, err := cs.Inspect("test/a:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sn := cs.cli.SnapshotService(cs.driver)
+	top := details.Manifests[0].ChainID.String()
+	if _, err = sn.View(ctx, "test-view", top); err != nil {
+		t.Fatal(err)
+	}
+
+	du, err := cs.DiskUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Expected usage computed from the image descriptors and the snapshot usage
+	var contentSize int64
+	err = cs.cli.ContentStore().Walk(cs.ctx, func(info content.Info) error {
+		contentSize += info.Size
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if du.ContentSize != contentSize {
+		t.Errorf("expected content size %d, got %d", contentSize, du.ContentSize)
+	}
+	usage := func(key string) int64 {
+		t.Helper()
+		u, err := sn.Usage(cs.ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u.Size
+	}
+
+	if len(du.Images) != 2 || du.Images[0].Name != "test/a:latest" || du.Images[1].Name != "test/b:latest" {
+		t.Fatalf("expected usage of both images sorted by name, got %+v", du.Images)
+	}
+	var snapshotsSize int64
+	for _, iu := range du.Images {
+		details, err := cs.Inspect(iu.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		md := details.Manifests[0]
+		layers := md.Manifest.Layers
+		baseChain := md.Layers[0].DiffID.String()
+		exclusive := md.Descriptor.Size + md.Manifest.Config.Size + layers[1].Size + usage(md.ChainID.String())
+		shared := layers[0].Size + usage(baseChain)
+		if iu.Digest != details.Target.Digest {
+			t.Errorf("%s: expected digest %s, got %s", iu.Name, details.Target.Digest, iu.Digest)
+		}
+		if iu.Shared != shared || iu.Exclusive != exclusive {
+			t.Errorf("%s: expected %d shared and %d exclusive bytes, got %d and %d", iu.Name, shared, exclusive, iu.Shared, iu.Exclusive)
+		}
+		if iu.ContentSize+iu.UnpackedSize != iu.Shared+iu.Exclusive {
+			t.Errorf("%s: shared and exclusive bytes do not add up to the image size: %+v", iu.Name, iu)
+		}
+		snapshotsSize += usage(md.ChainID.String())
+		if iu.Name == "test/a:latest" {
+			snapshotsSize += usage(baseChain)
+		}
+	}
+	snapshotsSize += usage("test-view")
+	if du.SnapshotsSize != snapshotsSize {
+		t.Errorf("expected snapshots size %d, got %d", snapshotsSize, du.SnapshotsSize)
+	}
+
+	if len(du.Snapshots) != 1 || du.Snapshots[0].Key != "test-view" ||
+		du.Snapshots[0].Kind != snapshots.KindView || du.Snapshots[0].Parent != top {
+		t.Errorf("expected only the view among active snapshots, got %+v", du.Snapshots)
+	}
+	// Imports leave the index of their archive behind
+	gc, err := cs.GarbageCollect(WithGCDryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if du.Reclaimable != gc.Bytes {
+		t.Errorf("expected %d reclaimable bytes, got %d", gc.Bytes, du.Reclaimable)
+	}
+	reclaimable := du.Reclaimable
+
+	// Content left by b alone is no longer shared and can be reclaimed
+	if err = cs.cli.ImageService().Delete(cs.ctx, "test/b:latest"); err != nil {
+		t.Fatal(err)
+	}
+	du, err = cs.DiskUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(du.Images) != 1 || du.Images[0].Shared != 0 {
+		t.Errorf("expected the remaining image not to share anything, got %+v", du.Images)
+	}
+	if du.Reclaimable <= reclaimable {
+		t.Errorf("expected the content of the deleted image to be reclaimable, got %d bytes", du.Reclaimable)
+	}
+}
@@ -0,0 +1,187 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/containerd/containerd/v2/core/images/archive"
+	"github.com/containerd/errdefs"
+	"github.com/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// ExportFormatOCI exports archives in OCI image layout only
+	ExportFormatOCI = "oci"
+	// ExportFormatDocker exports OCI image layout archives including a docker compatible
+	// manifest.json, so they can be loaded with 'docker load' too
+	ExportFormatDocker = "docker"
+)
+
+type ExportOpts struct {
+	eOpts        []archive.ExportOpt
+	format       string
+	platforms    []ocispec.Platform
+	allPlatforms bool
+	gzip         bool
+}
+
+type ExportOpt func(*ExportOpts) error
+
+func WithExportOpts(opts ...archive.ExportOpt) ExportOpt {
+	return func(eOpts *ExportOpts) error {
+		eOpts.eOpts = append(eOpts.eOpts, opts...)
+		return nil
+	}
+}
+
+// WithExportFormat sets the archive format, ExportFormatDocker by default
+func WithExportFormat(format string) ExportOpt {
+	return func(eOpts *ExportOpts) error {
+		if format != ExportFormatOCI && format != ExportFormatDocker {
+			return fmt.Errorf("invalid export format '%s', expected '%s' or '%s': %w", format, ExportFormatOCI, ExportFormatDocker, errdefs.ErrInvalidArgument)
+		}
+		eOpts.format = format
+		return nil
+	}
+}
+
+// WithExportPlatforms sets the platforms to export from multi-platform images, defaults to the
+// store platform. The first one is used for the docker compatible manifest.
+func WithExportPlatforms(platforms ...ocispec.Platform) ExportOpt {
+	return func(eOpts *ExportOpts) error {
+		eOpts.platforms = append(eOpts.platforms, platforms...)
+		return nil
+	}
+}
+
+// WithExportAllPlatforms exports all platforms of multi-platform images, the content of all
+// platforms must be available in the store
+func WithExportAllPlatforms() ExportOpt {
+	return func(eOpts *ExportOpts) error {
+		eOpts.allPlatforms = true
+		return nil
+	}
+}
+
+// WithExportGzip compresses the archive with gzip
+func WithExportGzip() ExportOpt {
+	return func(eOpts *ExportOpts) error {
+		eOpts.gzip = true
+		return nil
+	}
+}
+
+// Export writes the given images to an archive, including the content of the selected platforms
+func (c *OCIStore) Export(writer io.Writer, refs []string, opts ...ExportOpt) error {
+	release, err := c.startOp()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	err = c.export(c.ctx, writer, refs, opts...)
+	if err != nil {
+		c.log.Errorf("failed exporting images: %v", err)
+		return err
+	}
+
+	c.log.Infof("Successfully exported %d image(s)", len(refs))
+	return nil
+}
+
+// ExportFile writes the given images to an archive file, see Export
+func (c *OCIStore) ExportFile(file string, refs []string, opts ...ExportOpt) (retErr error) {
+	release, err := c.startOp()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := f.Close()
+		if err != nil && retErr == nil {
+			retErr = err
+		}
+		if retErr != nil {
+			os.Remove(file)
+		}
+	}()
+
+	err = c.export(c.ctx, f, refs, opts...)
+	if err != nil {
+		c.log.Errorf("failed exporting images to file '%s': %v", file, err)
+		return err
+	}
+
+	c.log.Infof("Successfully exported %d image(s) to '%s'", len(refs), file)
+	return nil
+}
+
+func (c *OCIStore) export(ctx context.Context, writer io.Writer, refs []string, opts ...ExportOpt) (retErr error) {
+	eOpt := &ExportOpts{format: ExportFormatDocker}
+	for _, o := range opts {
+		err := o(eOpt)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(refs) == 0 {
+		return fmt.Errorf("no images to export: %w", errdefs.ErrInvalidArgument)
+	}
+
+	platform := c.platform
+	if len(eOpt.platforms) > 0 {
+		platform = platforms.Ordered(eOpt.platforms...)
+	}
+	archiveOpts := []archive.ExportOpt{archive.WithPlatform(platform)}
+	if eOpt.allPlatforms {
+		archiveOpts = append(archiveOpts, archive.WithAllPlatforms())
+	}
+	if eOpt.format == ExportFormatOCI {
+		archiveOpts = append(archiveOpts, archive.WithSkipDockerManifest())
+	}
+	is := c.cli.ImageService()
+	for _, ref := range refs {
+		archiveOpts = append(archiveOpts, archive.WithImage(is, ref))
+	}
+	// Appended so options given by the caller take precedence
+	archiveOpts = append(archiveOpts, eOpt.eOpts...)
+
+	if eOpt.gzip {
+		gw := gzip.NewWriter(writer)
+		defer func() {
+			err := gw.Close()
+			if err != nil && retErr == nil {
+				retErr = err
+			}
+		}()
+		writer = gw
+	}
+
+	return c.cli.Export(ctx, writer, archiveOpts...)
+}
@@ -0,0 +1,131 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	host := platforms.DefaultSpec()
+	other := ocispec.Platform{OS: "linux", Architecture: "riscv64"}
+	if platforms.Only(host).Match(other) {
+		other.Architecture = "s390x"
+	}
+
+	src := newTestStore(t, t.TempDir())
+	archive := writeTestArchive(t, "test/multi:latest", []ocispec.Platform{host, other}, testLayer{"file": "data"})
+	if _, err := src.ImportFile(archive, WithImportPlatforms(host, other)); err != nil {
+		t.Fatal(err)
+	}
+	importTestImage(t, src, "test/single:latest", testLayer{"a": "a"}, testLayer{"b": "b"})
+
+	for name, tc := range map[string]struct {
+		opts    []ExportOpt
+		gzip    bool
+		docker  bool
+		missing []string
+	}{
+		"docker":        {nil, false, true, []string{platforms.Format(other)}},
+		"oci":           {[]ExportOpt{WithExportFormat(ExportFormatOCI)}, false, false, []string{platforms.Format(other)}},
+		"gzip":          {[]ExportOpt{WithExportGzip()}, true, true, []string{platforms.Format(other)}},
+		"all platforms": {[]ExportOpt{WithExportAllPlatforms()}, false, true, nil},
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "export.tar")
+			if err := src.ExportFile(file, []string{"test/multi:latest", "test/single:latest"}, tc.opts...); err != nil {
+				t.Fatal(err)
+			}
+			if files := archiveFiles(t, file, tc.gzip); slices.Contains(files, "manifest.json") != tc.docker {
+				t.Errorf("expected docker manifest in archive to be %v, got files %v", tc.docker, files)
+			}
+
+			dst := newTestStore(t, t.TempDir())
+			imgs, err := dst.ImportFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(imgs) != 2 {
+				t.Fatalf("expected two imported images, got %d", len(imgs))
+			}
+			for _, ref := range []string{"test/multi:latest", "test/single:latest"} {
+				want, err := src.cli.ImageService().Get(src.ctx, ref)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := dst.cli.ImageService().Get(dst.ctx, ref)
+				if err != nil {
+					t.Fatalf("image '%s' not imported: %v", ref, err)
+				}
+				if got.Target.Digest != want.Target.Digest {
+					t.Errorf("image '%s' changed from '%s' to '%s'", ref, want.Target.Digest, got.Target.Digest)
+				}
+				missing, err := dst.incompletePlatforms(dst.ctx, got.Target)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ref == "test/single:latest" && len(missing) > 0 {
+					t.Errorf("expected complete image '%s', missing %v", ref, missing)
+				} else if ref == "test/multi:latest" && !slices.Equal(missing, tc.missing) {
+					t.Errorf("expected image '%s' to miss platforms %v, got %v", ref, tc.missing, missing)
+				}
+			}
+		})
+	}
+}
+
+// archiveFiles lists the files of the given tar archive
+func archiveFiles(t *testing.T, file string, compressed bool) []string {
+	t.Helper()
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if compressed {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("archive is not gzip compressed: %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	var files []string
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, hdr.Name)
+	}
+}
@@ -0,0 +1,524 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/metadata"
+	"github.com/containerd/containerd/v2/core/mount"
+	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/containerd/v2/pkg/namespaces"
+	"github.com/containerd/errdefs"
+	"github.com/opencontainers/go-digest"
+	bolt "go.etcd.io/bbolt"
+)
+
+// GCReport describes the data released by a garbage collection, or the data that would be
+// released in case of a dry run
+type GCReport struct {
+	DryRun    bool
+	Content   []GCContent
+	Snapshots []GCSnapshot
+	Leases    []GCLease
+	// Bytes is the disk space released by the removed content and snapshots
+	Bytes int64
+}
+
+// GCContent is a content blob, or an unfinished ingest if Ref is set, removed by the garbage collector
+type GCContent struct {
+	Digest digest.Digest
+	Ref    string
+	Size   int64
+}
+
+// GCSnapshot is a snapshot removed by the garbage collector. Namespace and Key are only known for
+// snapshots referenced from the metadata database, Name is the key used by the driver.
+type GCSnapshot struct {
+	Driver    string
+	Namespace string
+	Key       string
+	Name      string
+	Size      int64
+}
+
+// GCLease is an expired lease removed by the garbage collector
+type GCLease struct {
+	Namespace string
+	ID        string
+}
+
+type GCOpts struct {
+	dryRun bool
+}
+
+type GCOpt func(*GCOpts) error
+
+// WithGCDryRun reports what the garbage collector would remove without removing anything
+func WithGCDryRun() GCOpt {
+	return func(gOpts *GCOpts) error {
+		gOpts.dryRun = true
+		return nil
+	}
+}
+
+// GarbageCollect removes the content, snapshots and leases no longer referenced by any image or
+// lease of any namespace and returns a report of the removed data
+func (c *OCIStore) GarbageCollect(opts ...GCOpt) (*GCReport, error) {
+	gOpt := &GCOpts{}
+	for _, o := range opts {
+		err := o(gOpt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// A dry run operates on a copy of the metadata, hence it is not a mutating operation
+	startOp := c.startWriteOp
+	if gOpt.dryRun {
+		startOp = c.startOp
+	}
+	release, err := startOp()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	report, err := c.garbageCollect(c.ctx, gOpt.dryRun)
+	if err != nil {
+		c.log.Errorf("failed to collect garbage: %v", err)
+		return nil, err
+	}
+	return report, nil
+}
+
+// autoGC runs the garbage collector if the store policy requires so, failures are only logged
+func (c *OCIStore) autoGC() {
+	if !c.gcPolicy.Auto {
+		return
+	}
+	report, err := c.garbageCollect(c.ctx, false)
+	if err != nil {
+		c.log.Warnf("automatic garbage collection failed: %v", err)
+		return
+	}
+	c.log.Debugf(
+		"garbage collection removed %d blob(s), %d snapshot(s) and %d lease(s), %d bytes released",
+		len(report.Content), len(report.Snapshots), len(report.Leases), report.Bytes,
+	)
+}
+
+func (c *OCIStore) garbageCollect(ctx context.Context, dryRun bool) (*GCReport, error) {
+	c.gcL.Lock()
+	defer c.gcL.Unlock()
+
+	if !dryRun {
+		return c.collect(ctx, c.db, c.bdb, c.gcRec, false)
+	}
+
+	db, bdb, rec, cleanup, err := c.dryRunDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	return c.collect(ctx, db, bdb, rec, true)
+}
+
+// dryRunDB opens a copy of the metadata database whose garbage collection does not remove
+// anything from the store backends. The returned cleanup function releases the copy.
+func (c *OCIStore) dryRunDB(ctx context.Context) (_ *metadata.DB, _ *bolt.DB, _ *gcRecorder, _ func(), retErr error) {
+	tmpDir, err := os.MkdirTemp("", "ocistore-gc-")
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	defer func() {
+		if retErr != nil {
+			os.RemoveAll(tmpDir)
+		}
+	}()
+
+	dbFile := filepath.Join(tmpDir, boltDbFile)
+	err = c.bdb.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(dbFile, 0600)
+	})
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	bdb, err := bolt.Open(dbFile, 0600, nil)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	cleanup := func() {
+		bdb.Close()
+		os.RemoveAll(tmpDir)
+	}
+
+	rec := &gcRecorder{dryRun: true}
+	db := metadata.NewDB(bdb, &gcContentStore{Store: c.content, rec: rec}, gcSnapshotters(c.snapshotters, rec))
+	if err = db.Init(ctx); err != nil {
+		bdb.Close()
+		return nil, nil, nil, nil, err
+	}
+	return db, bdb, rec, cleanup, nil
+}
+
+// collect runs the garbage collector of the given metadata database, callers must hold gcL
+func (c *OCIStore) collect(ctx context.Context, db *metadata.DB, bdb *bolt.DB, rec *gcRecorder, dryRun bool) (*GCReport, error) {
+	before, err := readGCState(bdb)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = markSnapshottersDirty(ctx, db); err != nil {
+		return nil, err
+	}
+
+	rec.start()
+	_, err = db.GarbageCollect(ctx)
+	removedContent, removedSnaps := rec.stop()
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := readGCState(bdb)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &GCReport{DryRun: dryRun, Content: removedContent}
+	for _, l := range before.leases {
+		if !after.hasLease(l) {
+			report.Leases = append(report.Leases, l)
+		}
+	}
+	for _, s := range removedSnaps {
+		if ref, ok := before.snapshots[s.Driver+"/"+s.Name]; ok {
+			s.Namespace, s.Key = ref.Namespace, ref.Key
+		}
+		report.Snapshots = append(report.Snapshots, s)
+		report.Bytes += s.Size
+	}
+	for _, ct := range report.Content {
+		report.Bytes += ct.Size
+	}
+	sort.Slice(report.Snapshots, func(i, j int) bool {
+		return report.Snapshots[i].Name < report.Snapshots[j].Name
+	})
+	sort.Slice(report.Content, func(i, j int) bool {
+		return report.Content[i].Digest+digest.Digest(report.Content[i].Ref) < report.Content[j].Digest+digest.Digest(report.Content[j].Ref)
+	})
+	return report, nil
+}
+
+// markSnapshottersDirty prepares and removes a placeholder snapshot on every driver. The metadata
+// database only cleans up the drivers it removed snapshots from since it was opened, this makes
+// sure snapshots removed by former processes are released too. The placeholder never reaches the
+// driver, see gcSnapshotter, and placeholders left by interrupted processes are removed on Init.
+func markSnapshottersDirty(ctx context.Context, db *metadata.DB) error {
+	for name, sn := range db.Snapshotters() {
+		if _, err := sn.Prepare(ctx, gcSweepKey, ""); err != nil && !errdefs.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to prepare garbage collection of driver '%s': %w", name, err)
+		}
+		if err := sn.Remove(ctx, gcSweepKey); err != nil {
+			return fmt.Errorf("failed to prepare garbage collection of driver '%s': %w", name, err)
+		}
+	}
+	return nil
+}
+
+// removeGCSweepSnapshots removes the placeholder snapshots of markSnapshottersDirty left behind by
+// processes interrupted while collecting garbage, from every namespace. Placeholders only exist in
+// the metadata database, hence they are looked up there.
+func removeGCSweepSnapshots(ctx context.Context, db *metadata.DB) error {
+	leftovers := map[string][]string{}
+	err := db.View(func(tx *bolt.Tx) error {
+		v1 := tx.Bucket([]byte("v1"))
+		if v1 == nil {
+			return nil
+		}
+		return v1.ForEach(func(ns, v []byte) error {
+			for name := range db.Snapshotters() {
+				if v == nil && nestedBucket(v1, string(ns), "snapshots", name, gcSweepKey) != nil {
+					leftovers[string(ns)] = append(leftovers[string(ns)], name)
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for ns, names := range leftovers {
+		nsCtx := namespaces.WithNamespace(ctx, ns)
+		for _, name := range names {
+			err = db.Snapshotter(name).Remove(nsCtx, gcSweepKey)
+			if err != nil && !errdefs.IsNotFound(err) {
+				return fmt.Errorf("failed to remove garbage collection placeholder of driver '%s' in namespace '%s': %w", name, ns, err)
+			}
+		}
+	}
+	return nil
+}
+
+// gcState holds the leases and snapshot references of the metadata database
+type gcState struct {
+	leases []GCLease
+	// snapshots maps driver keys, prefixed by the driver name, to their snapshot reference
+	snapshots map[string]GCSnapshot
+}
+
+func (s *gcState) hasLease(l GCLease) bool {
+	for _, ls := range s.leases {
+		if ls == l {
+			return true
+		}
+	}
+	return false
+}
+
+func readGCState(bdb *bolt.DB) (*gcState, error) {
+	state := &gcState{snapshots: map[string]GCSnapshot{}}
+	err := bdb.View(func(tx *bolt.Tx) error {
+		v1 := tx.Bucket([]byte("v1"))
+		if v1 == nil {
+			return nil
+		}
+		return v1.ForEach(func(ns, v []byte) error {
+			if v != nil {
+				return nil
+			}
+			if lbkt := nestedBucket(v1, string(ns), "leases"); lbkt != nil {
+				err := lbkt.ForEach(func(id, lv []byte) error {
+					if lv == nil {
+						state.leases = append(state.leases, GCLease{Namespace: string(ns), ID: string(id)})
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			sbkt := nestedBucket(v1, string(ns), "snapshots")
+			if sbkt == nil {
+				return nil
+			}
+			return sbkt.ForEach(func(driver, dv []byte) error {
+				dbkt := sbkt.Bucket(driver)
+				if dv != nil || dbkt == nil {
+					return nil
+				}
+				return dbkt.ForEach(func(key, kv []byte) error {
+					if kv != nil {
+						return nil
+					}
+					name := string(dbkt.Bucket(key).Get([]byte("name")))
+					state.snapshots[string(driver)+"/"+name] = GCSnapshot{
+						Driver: string(driver), Namespace: string(ns), Key: string(key), Name: name,
+					}
+					return nil
+				})
+			})
+		})
+	})
+	return state, err
+}
+
+// gcRecorder records the data removed from the store backends while the garbage collector runs.
+// On dry runs nothing is removed from the backends.
+type gcRecorder struct {
+	dryRun bool
+
+	mu        sync.Mutex
+	enabled   bool
+	content   []GCContent
+	snapshots []GCSnapshot
+}
+
+func (r *gcRecorder) start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enabled = true
+	r.content, r.snapshots = nil, nil
+}
+
+func (r *gcRecorder) stop() ([]GCContent, []GCSnapshot) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enabled = false
+	return r.content, r.snapshots
+}
+
+func (r *gcRecorder) isEnabled() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.enabled
+}
+
+func (r *gcRecorder) addContent(ct GCContent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.content = append(r.content, ct)
+}
+
+func (r *gcRecorder) addSnapshot(s GCSnapshot) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.snapshots = append(r.snapshots, s)
+}
+
+// gcContentStore wraps the content store backend to record removals while collecting garbage
+type gcContentStore struct {
+	content.Store
+	rec *gcRecorder
+}
+
+func (s *gcContentStore) Delete(ctx context.Context, dgst digest.Digest) error {
+	if !s.rec.isEnabled() {
+		return s.Store.Delete(ctx, dgst)
+	}
+
+	info, err := s.Store.Info(ctx, dgst)
+	if err != nil {
+		return err
+	}
+	if !s.rec.dryRun {
+		if err = s.Store.Delete(ctx, dgst); err != nil {
+			return err
+		}
+	}
+	s.rec.addContent(GCContent{Digest: dgst, Size: info.Size})
+	return nil
+}
+
+func (s *gcContentStore) Abort(ctx context.Context, ref string) error {
+	if !s.rec.isEnabled() {
+		return s.Store.Abort(ctx, ref)
+	}
+
+	st, err := s.Store.Status(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if !s.rec.dryRun {
+		if err = s.Store.Abort(ctx, ref); err != nil {
+			return err
+		}
+	}
+	s.rec.addContent(GCContent{Ref: ref, Size: st.Offset})
+	return nil
+}
+
+// WalkStatusRefs is used by the garbage collector to find unfinished ingests
+func (s *gcContentStore) WalkStatusRefs(ctx context.Context, fn func(string) error) error {
+	if w, ok := s.Store.(interface {
+		WalkStatusRefs(context.Context, func(string) error) error
+	}); ok {
+		return w.WalkStatusRefs(ctx, fn)
+	}
+
+	statuses, err := s.Store.ListStatuses(ctx)
+	if err != nil {
+		return err
+	}
+	for _, st := range statuses {
+		if err = fn(st.Ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gcSweepKey is the key of the placeholder snapshot used by markSnapshottersDirty
+const gcSweepKey = "ocistore-gc-sweep"
+
+// isGCSweepKey checks whether the given driver key, which is prefixed by the metadata database,
+// belongs to the placeholder snapshot
+func isGCSweepKey(key string) bool {
+	return strings.HasSuffix(key, "/"+gcSweepKey)
+}
+
+// gcSnapshotter wraps a driver to record removals while collecting garbage
+type gcSnapshotter struct {
+	snapshots.Snapshotter
+	driver string
+	rec    *gcRecorder
+}
+
+func gcSnapshotters(sns map[string]snapshots.Snapshotter, rec *gcRecorder) map[string]snapshots.Snapshotter {
+	wrapped := map[string]snapshots.Snapshotter{}
+	for name, sn := range sns {
+		wrapped[name] = &gcSnapshotter{Snapshotter: sn, driver: name, rec: rec}
+	}
+	return wrapped
+}
+
+func (s *gcSnapshotter) Prepare(ctx context.Context, key, parent string, opts ...snapshots.Opt) ([]mount.Mount, error) {
+	if isGCSweepKey(key) {
+		return nil, nil
+	}
+	return s.Snapshotter.Prepare(ctx, key, parent, opts...)
+}
+
+func (s *gcSnapshotter) Remove(ctx context.Context, key string) error {
+	if isGCSweepKey(key) {
+		return nil
+	}
+	if !s.rec.isEnabled() {
+		return s.Snapshotter.Remove(ctx, key)
+	}
+
+	var size int64
+	if usage, err := s.Snapshotter.Usage(ctx, key); err == nil {
+		size = usage.Size
+	}
+	if !s.rec.dryRun {
+		if err := s.Snapshotter.Remove(ctx, key); err != nil {
+			return err
+		}
+	}
+	s.rec.addSnapshot(GCSnapshot{Driver: s.driver, Name: key, Size: size})
+	return nil
+}
+
+// Walk ignores the missing metadata of drivers that never stored any snapshot
+func (s *gcSnapshotter) Walk(ctx context.Context, fn snapshots.WalkFunc, filters ...string) error {
+	err := s.Snapshotter.Walk(ctx, fn, filters...)
+	if errdefs.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// Cleanup releases the disk space of drivers removing snapshots asynchronously, drivers that never
+// stored any snapshot have nothing to release
+func (s *gcSnapshotter) Cleanup(ctx context.Context) error {
+	if c, ok := s.Snapshotter.(snapshots.Cleaner); ok && !s.rec.dryRun {
+		if err := c.Cleanup(ctx); err != nil && !errdefs.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/containerd/v2/pkg/namespaces"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestGarbageCollectDryRun(t *testing.T) {
+	root := t.TempDir()
+	cs := newTestStore(t, root)
+	importTestImage(t, cs, "test/img:keep", testLayer{"file": "keep"})
+	img, err := cs.Get("test/img:keep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cs.Unpack(img); err != nil {
+		t.Fatal(err)
+	}
+	importTestImage(t, cs, "test/img:drop", testLayer{"file": "drop"})
+	img, err = cs.Get("test/img:drop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cs.Unpack(img); err != nil {
+		t.Fatal(err)
+	}
+	if err = cs.Delete("test/img:drop", images.SynchronousDelete()); err != nil {
+		t.Fatal(err)
+	}
+
+	blobs := func() int {
+		t.Helper()
+		entries, err := os.ReadDir(filepath.Join(root, contentDir, "blobs", "sha256"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(entries)
+	}
+	before := blobs()
+
+	dry, err := cs.GarbageCollect(WithGCDryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dry.DryRun || len(dry.Content) == 0 || len(dry.Snapshots) == 0 || dry.Bytes == 0 {
+		t.Fatalf("expected the dry run to report the data of the deleted image, got %+v", dry)
+	}
+	if after := blobs(); after != before {
+		t.Errorf("dry run removed %d blobs", before-after)
+	}
+
+	report, err := cs.GarbageCollect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DryRun || len(report.Content) != len(dry.Content) || len(report.Snapshots) != len(dry.Snapshots) || report.Bytes != dry.Bytes {
+		t.Errorf("garbage collection %+v does not match its dry run %+v", report, dry)
+	}
+	if after := blobs(); after != before-len(report.Content) {
+		t.Errorf("expected %d blobs removed, got %d", len(report.Content), before-after)
+	}
+	if _, err = cs.Get("test/img:keep"); err != nil {
+		t.Errorf("referenced image lost: %v", err)
+	}
+
+	// Nothing left to collect
+	if report, err = cs.GarbageCollect(); err != nil {
+		t.Fatal(err)
+	} else if len(report.Content)+len(report.Snapshots)+len(report.Leases) != 0 {
+		t.Errorf("expected nothing else to collect, got %+v", report)
+	}
+}
+
+func TestGarbageCollectSweepLeftovers(t *testing.T) {
+	root := t.TempDir()
+	cs := newTestStore(t, root)
+	if err := cs.CreateNamespace("other", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Placeholders of a process interrupted while collecting garbage
+	sn := cs.cli.SnapshotService(NativeDriver)
+	for _, ns := range []string{DefaultNamespace, "other"} {
+		if _, err := sn.Prepare(namespaces.WithNamespace(cs.ctx, ns), gcSweepKey, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Placeholders never reach the driver, they are only found in the metadata database
+	cs = newTestStore(t, root)
+	err := cs.bdb.View(func(tx *bolt.Tx) error {
+		for _, ns := range []string{DefaultNamespace, "other"} {
+			if nestedBucket(tx.Bucket([]byte("v1")), ns, "snapshots", NativeDriver, gcSweepKey) != nil {
+				t.Errorf("garbage collection placeholder left in namespace '%s'", ns)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cs.ListSnapshots(); err != nil {
+		t.Errorf("failed to list snapshots: %v", err)
+	}
+}
@@ -0,0 +1,241 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/platforms"
+	"github.com/davidcassany/ocistore/pkg/logger"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// testLayer maps the paths of the files of a layer to their content
+type testLayer map[string]string
+
+func TestMain(m *testing.M) {
+	// Tests spawn the test binary itself to run helper processes, see helperProcess
+	if mode := os.Getenv(helperEnv); mode != "" {
+		os.Exit(runHelper(mode))
+	}
+	os.Exit(m.Run())
+}
+
+// newTestStore initiates a store on the given root with the native driver, so tests do not
+// depend on overlayfs or btrfs support. The store is closed at the end of the test.
+func newTestStore(t *testing.T, root string, opts ...StoreOpt) *OCIStore {
+	t.Helper()
+	cs := NewOCIStore(testLogger(t), root, append([]StoreOpt{WithDriver(NativeDriver)}, opts...)...)
+	if err := cs.Init(context.Background()); err != nil {
+		t.Fatalf("failed to init store: %v", err)
+	}
+	t.Cleanup(func() { _ = cs.Close() })
+	return cs
+}
+
+// testLogger returns a logger writing to the test log, so it is only shown for failed tests
+func testLogger(t *testing.T) logger.Logger {
+	t.Helper()
+	log, err := logger.NewLogger(logger.ErrorLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.SetOutput(testWriter{t})
+	return log
+}
+
+type testWriter struct {
+	t *testing.T
+}
+
+func (w testWriter) Write(p []byte) (int, error) {
+	w.t.Helper()
+	w.t.Log(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+// importTestImage imports an image with the given layers for the host platform
+func importTestImage(t *testing.T, cs *OCIStore, name string, layers ...testLayer) images.Image {
+	t.Helper()
+	archive := writeTestArchive(t, name, []ocispec.Platform{platforms.DefaultSpec()}, layers...)
+	imgs, err := cs.ImportFile(archive)
+	if err != nil {
+		t.Fatalf("failed to import image '%s': %v", name, err)
+	}
+	if len(imgs) != 1 {
+		t.Fatalf("expected one imported image, got %d", len(imgs))
+	}
+	return imgs[0].Metadata()
+}
+
+// writeTestArchive writes an OCI archive of an image named name with the given layers. A single
+// platform produces a plain manifest, several ones an index with a manifest per platform. In that
+// case every manifest gets an additional layer with its platform in the 'platform' file, so each
+// platform unpacks into its own snapshots.
+func writeTestArchive(t *testing.T, name string, ps []ocispec.Platform, layers ...testLayer) string {
+	t.Helper()
+	return writeTestArchiveWithConfig(t, name, ps, nil, layers...)
+}
+
+// writeTestArchiveWithConfig writes an archive as writeTestArchive does, the image config of
+// every platform is passed to setConfig, if any, before it is written
+func writeTestArchiveWithConfig(t *testing.T, name string, ps []ocispec.Platform, setConfig func(*ocispec.Image), layers ...testLayer) string {
+	t.Helper()
+	blobs := map[digest.Digest][]byte{}
+	addBlob := func(mediaType string, b []byte) ocispec.Descriptor {
+		d := digest.FromBytes(b)
+		blobs[d] = b
+		return ocispec.Descriptor{MediaType: mediaType, Digest: d, Size: int64(len(b))}
+	}
+	addJSON := func(mediaType string, v any) ocispec.Descriptor {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return addBlob(mediaType, b)
+	}
+
+	var manifests []ocispec.Descriptor
+	for _, p := range ps {
+		config := ocispec.Image{Platform: p, RootFS: ocispec.RootFS{Type: "layers"}}
+		var layerDescs []ocispec.Descriptor
+		pLayers := layers
+		if len(ps) > 1 {
+			pLayers = append(slices.Clone(layers), testLayer{"platform": platforms.Format(p)})
+		}
+		for _, l := range pLayers {
+			tarball := tarLayer(t, l)
+			config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, digest.FromBytes(tarball))
+			layerDescs = append(layerDescs, addBlob(ocispec.MediaTypeImageLayerGzip, gzipBytes(t, tarball)))
+		}
+		if setConfig != nil {
+			setConfig(&config)
+		}
+		mani := ocispec.Manifest{
+			Versioned: specs.Versioned{SchemaVersion: 2},
+			MediaType: ocispec.MediaTypeImageManifest,
+			Config:    addJSON(ocispec.MediaTypeImageConfig, config),
+			Layers:    layerDescs,
+		}
+		desc := addJSON(ocispec.MediaTypeImageManifest, mani)
+		desc.Platform = &p
+		manifests = append(manifests, desc)
+	}
+
+	root := manifests[0]
+	root.Platform = nil
+	if len(manifests) > 1 {
+		root = addJSON(ocispec.MediaTypeImageIndex, ocispec.Index{
+			Versioned: specs.Versioned{SchemaVersion: 2},
+			MediaType: ocispec.MediaTypeImageIndex,
+			Manifests: manifests,
+		})
+	}
+	root.Annotations = map[string]string{images.AnnotationImageName: name}
+
+	files := map[string][]byte{
+		ocispec.ImageLayoutFile: []byte(`{"imageLayoutVersion":"1.0.0"}`),
+	}
+	index, err := json.Marshal(ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: []ocispec.Descriptor{root},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files[ocispec.ImageIndexFile] = index
+	for d, b := range blobs {
+		files["blobs/"+d.Algorithm().String()+"/"+d.Encoded()] = b
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "archive-*.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	writeTar(t, f, files)
+	return f.Name()
+}
+
+func tarLayer(t *testing.T, l testLayer) []byte {
+	t.Helper()
+	files := map[string][]byte{}
+	for path, data := range l {
+		files[path] = []byte(data)
+	}
+	var buf bytes.Buffer
+	writeTar(t, &buf, files)
+	return buf.Bytes()
+}
+
+// writeTar writes the given files sorted by path, so layers are reproducible
+func writeTar(t *testing.T, w interface{ Write([]byte) (int, error) }, files map[string][]byte) {
+	t.Helper()
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	tw := tar.NewWriter(w)
+	for _, p := range paths {
+		hdr := &tar.Header{Name: p, Mode: 0644, Size: int64(len(files[p])), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(files[p]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// requireRoot skips tests mounting snapshots when not running as root
+func requireRoot(t *testing.T) {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("test requires root privileges")
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"fmt"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// HistoryEntry is a history record of an image config paired with the layer it created, Layer
+// is nil for empty layers
+type HistoryEntry struct {
+	ocispec.History
+	Layer  *ocispec.Descriptor `json:",omitempty"`
+	DiffID digest.Digest       `json:",omitempty"`
+}
+
+// History returns the history of the given image for the store platform, oldest entry first
+func (c *OCIStore) History(ref string) ([]HistoryEntry, error) {
+	release, err := c.startOp()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	img, err := c.cli.GetImage(c.ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	config, _, err := ReadImageConfig(c.ctx, img)
+	if err != nil {
+		c.log.Errorf("failed to read config of image '%s': %v", ref, err)
+		return nil, err
+	}
+	manifest, _, err := ReadManifest(c.ctx, img)
+	if err != nil {
+		c.log.Errorf("failed to read manifest of image '%s': %v", ref, err)
+		return nil, err
+	} else if manifest == nil {
+		return nil, fmt.Errorf("no manifest found for image '%s'", ref)
+	}
+
+	diffIDs := config.RootFS.DiffIDs
+	if len(diffIDs) != len(manifest.Layers) {
+		return nil, fmt.Errorf("mismatched layers and diffIDs in image '%s'", ref)
+	}
+
+	var entries []HistoryEntry
+	var layer int
+	for _, h := range config.History {
+		entry := HistoryEntry{History: h}
+		if !h.EmptyLayer {
+			if layer >= len(manifest.Layers) {
+				return nil, fmt.Errorf("image '%s' history has more layers than its manifest", ref)
+			}
+			entry.Layer = &manifest.Layers[layer]
+			entry.DiffID = diffIDs[layer]
+			layer++
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
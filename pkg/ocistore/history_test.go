@@ -0,0 +1,101 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/containerd/errdefs"
+	"github.com/containerd/platforms"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestHistory(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		c := created.Add(d)
+		return &c
+	}
+	history := []ocispec.History{
+		{Created: at(0), CreatedBy: "ADD rootfs.tar /"},
+		{Created: at(time.Minute), CreatedBy: "ENV PATH=/bin", EmptyLayer: true},
+		{Created: at(2 * time.Minute), CreatedBy: "RUN make", Author: "tester", Comment: "build"},
+		{Created: at(3 * time.Minute), CreatedBy: "CMD [\"/bin/sh\"]", EmptyLayer: true},
+	}
+	layers := []testLayer{{"rootfs": "base"}, {"bin/app": "app"}}
+
+	cs := newTestStore(t, t.TempDir())
+	ps := []ocispec.Platform{platforms.DefaultSpec()}
+	archive := writeTestArchiveWithConfig(t, "test/history:latest", ps, func(config *ocispec.Image) {
+		config.History = history
+	}, layers...)
+	if _, err := cs.ImportFile(archive); err != nil {
+		t.Fatal(err)
+	}
+	details, err := cs.Inspect("test/history:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestLayers := details.Manifests[0].Manifest.Layers
+
+	entries, err := cs.History("test/history:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(history) {
+		t.Fatalf("expected %d history entries, got %d", len(history), len(entries))
+	}
+	layer := 0
+	for i, e := range entries {
+		if e.CreatedBy != history[i].CreatedBy || !e.Created.Equal(*history[i].Created) ||
+			e.Author != history[i].Author || e.Comment != history[i].Comment {
+			t.Errorf("entry %d: expected %+v, got %+v", i, history[i], e.History)
+		}
+		if history[i].EmptyLayer {
+			if e.Layer != nil || e.DiffID != "" || !e.EmptyLayer {
+				t.Errorf("entry %d: expected an empty layer, got %+v", i, e)
+			}
+			continue
+		}
+		if e.Layer == nil {
+			t.Fatalf("entry %d: expected layer %d, got none", i, layer)
+		}
+		if e.Layer.Digest != manifestLayers[layer].Digest || e.Layer.Size != manifestLayers[layer].Size {
+			t.Errorf("entry %d: expected layer %v, got %v", i, manifestLayers[layer], *e.Layer)
+		}
+		if want := digest.FromBytes(tarLayer(t, layers[layer])); e.DiffID != want {
+			t.Errorf("entry %d: expected diffID %s, got %s", i, want, e.DiffID)
+		}
+		layer++
+	}
+
+	// Histories referencing more layers than the image has are refused
+	archive = writeTestArchiveWithConfig(t, "test/broken:latest", ps, func(config *ocispec.Image) {
+		config.History = append(history, ocispec.History{CreatedBy: "RUN missing"})
+	}, layers...)
+	if _, err = cs.ImportFile(archive); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cs.History("test/broken:latest"); err == nil {
+		t.Error("expected an error for a history with more layers than the image")
+	}
+	if _, err = cs.History("test/missing:latest"); !errdefs.IsNotFound(err) {
+		t.Errorf("expected a not found error, got: %v", err)
+	}
+}
@@ -18,17 +18,23 @@ package ocistore
 
 import (
 	"context"
-	"errors"
+	"fmt"
 
 	"github.com/containerd/containerd/v2/client"
 	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/errdefs"
+	"github.com/opencontainers/go-digest"
 	"github.com/opencontainers/image-spec/identity"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 func (c *OCIStore) Get(ref string) (client.Image, error) {
-	if !c.IsInitiated() {
-		return nil, errors.New(missInitErrMsg)
+	release, err := c.startOp()
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
 	img, err := c.cli.GetImage(c.ctx, ref)
 	if err != nil {
@@ -39,9 +45,11 @@ func (c *OCIStore) Get(ref string) (client.Image, error) {
 }
 
 func (c *OCIStore) List(filters ...string) ([]client.Image, error) {
-	if !c.IsInitiated() {
-		return nil, errors.New(missInitErrMsg)
+	release, err := c.startOp()
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
 	images, err := c.cli.ListImages(c.ctx, filters...)
 	if err != nil {
@@ -52,11 +60,20 @@ func (c *OCIStore) List(filters ...string) ([]client.Image, error) {
 }
 
 func (c *OCIStore) Delete(name string, opts ...images.DeleteOpt) (retErr error) {
-	if !c.IsInitiated() {
-		return errors.New(missInitErrMsg)
+	release, err := c.startWriteOp()
+	if err != nil {
+		return err
 	}
+	defer release()
+
+	// Deferred before the lease removal so it runs once the operation lease is gone
+	defer func() {
+		if retErr == nil {
+			c.autoGC()
+		}
+	}()
 
-	ctx, done, err := c.cli.WithLease(c.ctx)
+	ctx, done, err := c.withLease(c.ctx)
 	if err != nil {
 		c.log.Errorf("failed to create lease to delete image: %v", err)
 		return err
@@ -79,11 +96,13 @@ func (c *OCIStore) Delete(name string, opts ...images.DeleteOpt) (retErr error)
 }
 
 func (c *OCIStore) Update(img images.Image, fieldpaths ...string) (_ client.Image, retErr error) {
-	if !c.IsInitiated() {
-		return nil, errors.New(missInitErrMsg)
+	release, err := c.startWriteOp()
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
-	ctx, done, err := c.cli.WithLease(c.ctx)
+	ctx, done, err := c.withLease(c.ctx)
 	if err != nil {
 		c.log.Errorf("failed to create lease to update image: %v", err)
 		return nil, err
@@ -104,11 +123,13 @@ func (c *OCIStore) Update(img images.Image, fieldpaths ...string) (_ client.Imag
 }
 
 func (c *OCIStore) Create(img images.Image) (_ client.Image, retErr error) {
-	if !c.IsInitiated() {
-		return nil, errors.New(missInitErrMsg)
+	release, err := c.startWriteOp()
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
-	ctx, done, err := c.cli.WithLease(c.ctx)
+	ctx, done, err := c.withLease(c.ctx)
 	if err != nil {
 		c.log.Errorf("failed to create lease to create image: %v", err)
 		return nil, err
@@ -128,6 +149,56 @@ func (c *OCIStore) Create(img images.Image) (_ client.Image, retErr error) {
 	return client.NewImage(c.cli, i), nil
 }
 
+// Tag creates the image dst pointing to the same target than src. An existing dst image is
+// only replaced if force is set.
+func (c *OCIStore) Tag(src, dst string, force bool) (_ client.Image, retErr error) {
+	release, err := c.startWriteOp()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	ctx, done, err := c.withLease(c.ctx)
+	if err != nil {
+		c.log.Errorf("failed to create lease to tag image: %v", err)
+		return nil, err
+	}
+	defer func() {
+		err = done(ctx)
+		if err != nil && retErr == nil {
+			c.log.Warnf("could not remove lease on tag image operation")
+		}
+	}()
+
+	is := c.cli.ImageService()
+	srcImg, err := is.Get(ctx, src)
+	if err != nil {
+		c.log.Errorf("failed to get image '%s': %v", src, err)
+		return nil, err
+	}
+
+	img := images.Image{
+		Name:   dst,
+		Target: srcImg.Target,
+		Labels: srcImg.Labels,
+	}
+	i, err := is.Create(ctx, img)
+	if errdefs.IsAlreadyExists(err) && force {
+		i, err = is.Update(ctx, img)
+	}
+	if errdefs.IsAlreadyExists(err) {
+		return nil, fmt.Errorf("image '%s' already exists, use force to replace it: %w", dst, errdefs.ErrAlreadyExists)
+	} else if err != nil {
+		c.log.Errorf("failed to tag image '%s' as '%s': %v", src, dst, err)
+		return nil, err
+	}
+
+	c.log.Infof("Successfully tagged image '%s' as '%s'", src, dst)
+	return client.NewImage(c.cli, i), nil
+}
+
+// delete removes the given image and its unpacked snapshots, snapshots also used by any other
+// image are kept
 func (c *OCIStore) delete(ctx context.Context, name string, opts ...images.DeleteOpt) error {
 	img, err := c.cli.GetImage(ctx, name)
 	if err != nil {
@@ -138,15 +209,107 @@ func (c *OCIStore) delete(ctx context.Context, name string, opts ...images.Delet
 		if err != nil {
 			return err
 		}
-		chainID := identity.ChainID(diffIDs).String()
 		sn := c.cli.SnapshotService(c.driver)
-		err = c.removeSnapshotsChain(ctx, sn, chainID, -1)
+		inUse, err := c.imagesSnapshots(ctx, sn, name)
 		if err != nil {
 			return err
 		}
+
+		// Remove the chain from the top until a snapshot used by other images is found
+		chainIDs := identity.ChainIDs(diffIDs)
+		for i := len(chainIDs) - 1; i >= 0; i-- {
+			key := chainIDs[i].String()
+			if inUse[key] {
+				c.log.Debugf("keeping snapshot '%s', it is used by other images", key)
+				break
+			}
+			err = sn.Remove(ctx, key)
+			if errdefs.IsFailedPrecondition(err) {
+				// Snapshots having childs can't be removed
+				break
+			} else if err != nil && !errdefs.IsNotFound(err) {
+				return fmt.Errorf("error removing snapshot: %w", err)
+			}
+		}
 	} else if err != nil {
 		return err
 	}
 
 	return c.cli.ImageService().Delete(ctx, name, opts...)
 }
+
+// imagesSnapshots returns the unpacked snapshots, including their parents, of all platforms of
+// all images but the excluded one
+func (c *OCIStore) imagesSnapshots(ctx context.Context, sn snapshots.Snapshotter, exclude string) (map[string]bool, error) {
+	imgs, err := c.cli.ImageService().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	inUse := map[string]bool{}
+	for _, img := range imgs {
+		if img.Name == exclude {
+			continue
+		}
+		_, snaps, err := c.imageResources(ctx, sn, img)
+		if err != nil {
+			return nil, err
+		}
+		for key := range snaps {
+			inUse[key] = true
+		}
+	}
+	return inUse, nil
+}
+
+// imageResources returns the content blobs, with their size, and the unpacked snapshots, including
+// their parents, of all platforms of the given image available in the store
+func (c *OCIStore) imageResources(ctx context.Context, sn snapshots.Snapshotter, img images.Image) (map[digest.Digest]int64, map[string]bool, error) {
+	cs := c.cli.ContentStore()
+	label := "containerd.io/gc.ref.snapshot." + c.driver
+	blobs := map[digest.Digest]int64{}
+	snaps := map[string]bool{}
+	handler := images.HandlerFunc(func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		info, err := cs.Info(ctx, desc.Digest)
+		if errdefs.IsNotFound(err) {
+			// Content of platforms not fetched
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		blobs[desc.Digest] = info.Size
+
+		if images.IsConfigType(desc.MediaType) {
+			if key := info.Labels[label]; key != "" {
+				snaps[key] = true
+			}
+			return nil, nil
+		}
+		return images.Children(ctx, cs, desc)
+	})
+	if err := images.Walk(ctx, handler, img.Target); err != nil {
+		return nil, nil, fmt.Errorf("failed to walk image '%s': %w", img.Name, err)
+	}
+
+	tops := make([]string, 0, len(snaps))
+	for key := range snaps {
+		tops = append(tops, key)
+	}
+	for _, key := range tops {
+		for {
+			info, err := sn.Stat(ctx, key)
+			if errdefs.IsNotFound(err) {
+				delete(snaps, key)
+				break
+			} else if err != nil {
+				return nil, nil, err
+			}
+			if info.Parent == "" || snaps[info.Parent] {
+				break
+			}
+			key = info.Parent
+			snaps[key] = true
+		}
+	}
+	return blobs, snaps, nil
+}
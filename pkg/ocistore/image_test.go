@@ -0,0 +1,111 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"testing"
+
+	"github.com/containerd/errdefs"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/identity"
+)
+
+func TestTag(t *testing.T) {
+	cs := newTestStore(t, t.TempDir())
+	src := importTestImage(t, cs, "test/img:src", testLayer{"file": "src"})
+	other := importTestImage(t, cs, "test/img:other", testLayer{"file": "other"})
+
+	img, err := cs.Tag("test/img:src", "test/img:copy", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Target().Digest != src.Target.Digest {
+		t.Errorf("expected tag to point to '%s', got '%s'", src.Target.Digest, img.Target().Digest)
+	}
+
+	if _, err = cs.Tag("test/img:other", "test/img:copy", false); !errdefs.IsAlreadyExists(err) {
+		t.Errorf("expected an already exists error, got: %v", err)
+	}
+	if img, err = cs.Tag("test/img:other", "test/img:copy", true); err != nil {
+		t.Fatal(err)
+	} else if img.Target().Digest != other.Target.Digest {
+		t.Errorf("expected forced tag to point to '%s', got '%s'", other.Target.Digest, img.Target().Digest)
+	}
+	if _, err = cs.Tag("test/img:missing", "test/img:copy", true); !errdefs.IsNotFound(err) {
+		t.Errorf("expected a not found error, got: %v", err)
+	}
+}
+
+func TestDeleteSharedSnapshots(t *testing.T) {
+	cs := newTestStore(t, t.TempDir())
+	base, child := testLayer{"base": "base"}, testLayer{"child": "child"}
+	importTestImage(t, cs, "test/base:latest", base)
+	importTestImage(t, cs, "test/child:latest", base, child)
+	if _, err := cs.Tag("test/base:latest", "test/base:alias", false); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"test/base:latest", "test/child:latest"} {
+		img, err := cs.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = cs.Unpack(img); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chain := identity.ChainIDs([]digest.Digest{digest.FromBytes(tarLayer(t, base)), digest.FromBytes(tarLayer(t, child))})
+	baseKey, childKey := chain[0].String(), chain[1].String()
+	sn := cs.cli.SnapshotService(cs.driver)
+	exists := func(key string) bool {
+		t.Helper()
+		_, err := sn.Stat(cs.ctx, key)
+		if err != nil && !errdefs.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		return err == nil
+	}
+	if !exists(baseKey) || !exists(childKey) {
+		t.Fatal("images not unpacked")
+	}
+
+	// Tags share all their snapshots
+	if err := cs.Delete("test/base:alias"); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(baseKey) {
+		t.Error("snapshot of the tagged image removed")
+	}
+
+	// Only the snapshots not used by other images are removed
+	if err := cs.Delete("test/child:latest"); err != nil {
+		t.Fatal(err)
+	}
+	if exists(childKey) {
+		t.Error("snapshot of the deleted image kept")
+	}
+	if !exists(baseKey) {
+		t.Error("snapshot shared with another image removed")
+	}
+
+	if err := cs.Delete("test/base:latest"); err != nil {
+		t.Fatal(err)
+	}
+	if exists(baseKey) {
+		t.Error("snapshot of the last image using it kept")
+	}
+}
@@ -18,18 +18,21 @@ package ocistore
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"os"
 
 	"github.com/containerd/containerd/v2/client"
+	"github.com/containerd/containerd/v2/pkg/archive/compression"
+	"github.com/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 type ImportOpts struct {
-	iOpts  []client.ImportOpt
-	aOpts  []ApplyCommitOpt
-	unpack bool
+	iOpts     []client.ImportOpt
+	aOpts     []ApplyCommitOpt
+	platforms []ocispec.Platform
+	unpack    bool
 }
 
 type ImportOpt func(*ImportOpts) error
@@ -48,6 +51,15 @@ func WithImportOpts(opts ...client.ImportOpt) ImportOpt {
 	}
 }
 
+// WithImportPlatforms sets the platforms to import the image content for, defaults to the store
+// platform. Images are unpacked for the first one.
+func WithImportPlatforms(platforms ...ocispec.Platform) ImportOpt {
+	return func(iOpts *ImportOpts) error {
+		iOpts.platforms = append(iOpts.platforms, platforms...)
+		return nil
+	}
+}
+
 func WithImportApplyCommitOpts(opts ...ApplyCommitOpt) ImportOpt {
 	return func(iOpts *ImportOpts) error {
 		iOpts.aOpts = append(iOpts.aOpts, opts...)
@@ -56,11 +68,13 @@ func WithImportApplyCommitOpts(opts ...ApplyCommitOpt) ImportOpt {
 }
 
 func (c *OCIStore) Import(reader io.Reader, opts ...ImportOpt) (_ []client.Image, retErr error) {
-	if !c.IsInitiated() {
-		return nil, errors.New(missInitErrMsg)
+	release, err := c.startWriteOp()
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
-	ctx, done, err := c.cli.WithLease(c.ctx)
+	ctx, done, err := c.withLease(c.ctx)
 	if err != nil {
 		c.log.Errorf("failed to create lease to import image: %v", err)
 		return nil, err
@@ -74,7 +88,8 @@ func (c *OCIStore) Import(reader io.Reader, opts ...ImportOpt) (_ []client.Image
 
 	images, err := c.importFunc(ctx, reader, opts...)
 	if err != nil {
-		c.log.Error("failed importing from reader interface")
+		c.log.Errorf("failed importing from reader interface: %v", err)
+		return images, err
 	}
 
 	c.log.Infof("Successfully imported %d image(s)", len(images))
@@ -82,11 +97,13 @@ func (c *OCIStore) Import(reader io.Reader, opts ...ImportOpt) (_ []client.Image
 }
 
 func (c *OCIStore) ImportFile(file string, opts ...ImportOpt) (_ []client.Image, retErr error) {
-	if !c.IsInitiated() {
-		return nil, errors.New(missInitErrMsg)
+	release, err := c.startWriteOp()
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
-	ctx, done, err := c.cli.WithLease(c.ctx)
+	ctx, done, err := c.withLease(c.ctx)
 	if err != nil {
 		c.log.Errorf("failed to create lease to import image: %v", err)
 		return nil, err
@@ -100,7 +117,8 @@ func (c *OCIStore) ImportFile(file string, opts ...ImportOpt) (_ []client.Image,
 
 	images, err := c.importFile(ctx, file, opts...)
 	if err != nil {
-		c.log.Errorf("failed importing from file '%s'", file)
+		c.log.Errorf("failed importing from file '%s': %v", file, err)
+		return images, err
 	}
 
 	c.log.Infof("Successfully imported %d image(s) from '%s'", len(images), file)
@@ -109,11 +127,13 @@ func (c *OCIStore) ImportFile(file string, opts ...ImportOpt) (_ []client.Image,
 }
 
 func (c *OCIStore) SingleImportFile(file string, opts ...ImportOpt) (_ client.Image, retErr error) {
-	if !c.IsInitiated() {
-		return nil, errors.New(missInitErrMsg)
+	release, err := c.startWriteOp()
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
-	ctx, done, err := c.cli.WithLease(c.ctx)
+	ctx, done, err := c.withLease(c.ctx)
 	if err != nil {
 		c.log.Errorf("failed to create lease to import image: %v", err)
 		return nil, err
@@ -127,7 +147,8 @@ func (c *OCIStore) SingleImportFile(file string, opts ...ImportOpt) (_ client.Im
 
 	images, err := c.importFile(ctx, file, opts...)
 	if err != nil {
-		c.log.Errorf("failed importing from file '%s'", file)
+		c.log.Errorf("failed importing from file '%s': %v", file, err)
+		return nil, err
 	}
 
 	if len(images) == 0 {
@@ -171,17 +192,34 @@ func (c *OCIStore) importFunc(ctx context.Context, reader io.Reader, opts ...Imp
 		}
 	}
 
+	platform := c.platform
+	cliOpts := iOpts.iOpts
+	aOpts := iOpts.aOpts
+	if len(iOpts.platforms) > 0 {
+		platform = platforms.OnlyStrict(iOpts.platforms[0])
+		// Prepended so platform options given by the caller take precedence
+		cliOpts = append([]client.ImportOpt{client.WithImportPlatform(platforms.Any(iOpts.platforms...))}, cliOpts...)
+		aOpts = append([]ApplyCommitOpt{WithUnpackPlatform(iOpts.platforms[0])}, aOpts...)
+	}
+
+	// Compressed archives, such as gzip exports, are decompressed on the fly
+	dr, err := compression.DecompressStream(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer dr.Close()
+
 	images := []client.Image{}
-	imgs, err := c.cli.Import(ctx, reader, iOpts.iOpts...)
+	imgs, err := c.cli.Import(ctx, dr, cliOpts...)
 	if err != nil {
 		return nil, err
 	}
 	var uErrs []error
 	for _, img := range imgs {
-		image := client.NewImage(c.cli, img)
+		image := client.NewImageWithPlatform(c.cli, img, platform)
 		images = append(images, image)
 		if iOpts.unpack {
-			err = c.unpack(ctx, image, iOpts.aOpts...)
+			err = c.unpack(ctx, image, aOpts...)
 			if err != nil {
 				c.log.Errorf("failed to unpack image '%s': %v", img.Name, err)
 				uErrs = append(uErrs, err)
@@ -0,0 +1,274 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/containerd/v2/pkg/archive/compression"
+	"github.com/containerd/containerd/v2/pkg/labels"
+	"github.com/containerd/errdefs"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/identity"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ImageDetails describes an image, its index if any, and the manifests of all its platforms
+type ImageDetails struct {
+	Name      string
+	Target    ocispec.Descriptor
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Labels    map[string]string `json:",omitempty"`
+	// Index is only set for multi-platform images
+	Index     *ocispec.Index `json:",omitempty"`
+	Manifests []ManifestDetails
+}
+
+// ManifestDetails describes the manifest of a platform of an image. Manifest, Config, Layers and
+// ChainID are only set if the manifest content is available in the store.
+type ManifestDetails struct {
+	Descriptor ocispec.Descriptor
+	Platform   *ocispec.Platform `json:",omitempty"`
+	Available  bool
+	// NonImage is set for manifests not describing an image, such as attestation manifests. Their
+	// Layers and ChainID are not set.
+	NonImage bool              `json:",omitempty"`
+	Manifest *ocispec.Manifest `json:",omitempty"`
+	Config   *ocispec.Image    `json:",omitempty"`
+	Layers   []LayerDetails    `json:",omitempty"`
+	ChainID  digest.Digest     `json:",omitempty"`
+	// Unpacked is set if the snapshot chain of the manifest exists in the store driver
+	Unpacked bool
+}
+
+// LayerDetails describes a layer, its descriptor size is the compressed size. UncompressedSize
+// is -1 if it is unknown, see Inspect.
+type LayerDetails struct {
+	ocispec.Descriptor
+	DiffID           digest.Digest
+	UncompressedSize int64
+}
+
+type InspectOpts struct {
+	decompress bool
+}
+
+type InspectOpt func(*InspectOpts) error
+
+// WithInspectDecompress computes the uncompressed size of layers by decompressing them if it is
+// not known otherwise, which requires reading all the layers content
+func WithInspectDecompress() InspectOpt {
+	return func(iOpts *InspectOpts) error {
+		iOpts.decompress = true
+		return nil
+	}
+}
+
+// Inspect returns the details of the given image for all its platforms available in the store.
+// Uncompressed layer sizes are taken from the store content of uncompressed layers or from the
+// disk usage of unpacked snapshots, layers are only decompressed if WithInspectDecompress is set.
+func (c *OCIStore) Inspect(ref string, opts ...InspectOpt) (*ImageDetails, error) {
+	iOpt := &InspectOpts{}
+	for _, o := range opts {
+		err := o(iOpt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	release, err := c.startOp()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	img, err := c.cli.ImageService().Get(c.ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	details, err := c.imageDetails(c.ctx, img, iOpt.decompress)
+	if err != nil {
+		c.log.Errorf("failed to inspect image '%s': %v", ref, err)
+		return nil, err
+	}
+	return details, nil
+}
+
+func (c *OCIStore) imageDetails(ctx context.Context, img images.Image, decompress bool) (*ImageDetails, error) {
+	cs := c.cli.ContentStore()
+	details := &ImageDetails{
+		Name:      img.Name,
+		Target:    img.Target,
+		CreatedAt: img.CreatedAt,
+		UpdatedAt: img.UpdatedAt,
+		Labels:    img.Labels,
+	}
+
+	manifests := []ocispec.Descriptor{img.Target}
+	if images.IsIndexType(img.Target.MediaType) {
+		details.Index = &ocispec.Index{}
+		if err := readJSONBlob(ctx, cs, img.Target, details.Index); err != nil {
+			return nil, err
+		}
+		manifests = details.Index.Manifests
+	}
+
+	for _, desc := range manifests {
+		md, err := c.manifestDetails(ctx, cs, desc, decompress)
+		if err != nil {
+			return nil, err
+		}
+		details.Manifests = append(details.Manifests, *md)
+	}
+	return details, nil
+}
+
+func (c *OCIStore) manifestDetails(ctx context.Context, cs content.Store, desc ocispec.Descriptor, decompress bool) (*ManifestDetails, error) {
+	md := &ManifestDetails{Descriptor: desc, Platform: desc.Platform}
+
+	mani := &ocispec.Manifest{}
+	err := readJSONBlob(ctx, cs, desc, mani)
+	if errdefs.IsNotFound(err) {
+		// Platforms not pulled
+		return md, nil
+	} else if err != nil {
+		return nil, err
+	}
+	md.Available = true
+	md.Manifest = mani
+	if !images.IsConfigType(mani.Config.MediaType) {
+		md.NonImage = true
+		return md, nil
+	}
+
+	config := &ocispec.Image{}
+	if err = readJSONBlob(ctx, cs, mani.Config, config); errdefs.IsNotFound(err) {
+		return md, nil
+	} else if err != nil {
+		return nil, err
+	}
+	md.Config = config
+	if md.Platform == nil {
+		md.Platform = &config.Platform
+	}
+
+	diffIDs := config.RootFS.DiffIDs
+	notLayer := func(l ocispec.Descriptor) bool { return !images.IsLayerType(l.MediaType) }
+	if len(diffIDs) != len(mani.Layers) || slices.ContainsFunc(mani.Layers, notLayer) {
+		md.NonImage = true
+		return md, nil
+	}
+	chainIDs := identity.ChainIDs(slices.Clone(diffIDs))
+	for i, l := range mani.Layers {
+		ld := LayerDetails{Descriptor: l, DiffID: diffIDs[i]}
+		ld.UncompressedSize, err = c.uncompressedSize(ctx, cs, l, chainIDs[:i+1], decompress)
+		if err != nil {
+			return nil, err
+		}
+		md.Layers = append(md.Layers, ld)
+	}
+
+	if len(diffIDs) > 0 {
+		md.ChainID = identity.ChainID(diffIDs)
+		_, err = c.cli.SnapshotService(c.driver).Stat(ctx, md.ChainID.String())
+		if err != nil && !errdefs.IsNotFound(err) {
+			return nil, err
+		}
+		md.Unpacked = err == nil
+	}
+	return md, nil
+}
+
+// uncompressedSize returns the size of the given layer once decompressed, chainIDs are the chain
+// of the layer. It is known without reading the layer for uncompressed layers, layers whose
+// uncompressed content is in the store and unpacked layers, otherwise layers are decompressed
+// if decompress is set. It is -1 if unknown.
+func (c *OCIStore) uncompressedSize(ctx context.Context, cs content.Store, desc ocispec.Descriptor, chainIDs []digest.Digest, decompress bool) (int64, error) {
+	if compressed, err := images.DiffCompression(ctx, desc.MediaType); err == nil && compressed == "" {
+		return desc.Size, nil
+	}
+
+	info, err := cs.Info(ctx, desc.Digest)
+	if errdefs.IsNotFound(err) {
+		return -1, nil
+	} else if err != nil {
+		return -1, err
+	}
+	if dgst, ok := info.Labels[labels.LabelUncompressed]; ok {
+		if uinfo, err := cs.Info(ctx, digest.Digest(dgst)); err == nil {
+			return uinfo.Size, nil
+		}
+	}
+
+	if size, ok := c.layerUsage(ctx, chainIDs); ok {
+		return size, nil
+	}
+
+	if !decompress {
+		return -1, nil
+	}
+	ra, err := cs.ReaderAt(ctx, desc)
+	if err != nil {
+		return -1, err
+	}
+	defer ra.Close()
+
+	dr, err := compression.DecompressStream(content.NewReader(ra))
+	if err != nil {
+		return -1, err
+	}
+	defer dr.Close()
+
+	if dr.GetCompression() == compression.Uncompressed {
+		return desc.Size, nil
+	}
+	return io.Copy(io.Discard, dr)
+}
+
+// layerUsage returns the disk usage of the unpacked snapshot of the last layer of the given chain.
+// Native snapshots are full copies of their parent, hence the usage of their parent is subtracted.
+func (c *OCIStore) layerUsage(ctx context.Context, chainIDs []digest.Digest) (int64, bool) {
+	sn := c.cli.SnapshotService(c.driver)
+	usage, err := sn.Usage(ctx, chainIDs[len(chainIDs)-1].String())
+	if err != nil {
+		return -1, false
+	}
+	if c.driver == NativeDriver && len(chainIDs) > 1 {
+		parent, err := sn.Usage(ctx, chainIDs[len(chainIDs)-2].String())
+		if err != nil {
+			return -1, false
+		}
+		return max(usage.Size-parent.Size, 0), true
+	}
+	return usage.Size, true
+}
+
+func readJSONBlob(ctx context.Context, cs content.Store, desc ocispec.Descriptor, v any) error {
+	b, err := content.ReadBlob(ctx, cs, desc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,169 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/containerd/v2/pkg/labels"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestInspectUncompressedSizes(t *testing.T) {
+	cs := newTestStore(t, t.TempDir())
+	layers := []testLayer{{"a": strings.Repeat("a", 8192)}, {"b": strings.Repeat("b", 16384)}}
+	importTestImage(t, cs, "test/img:latest", layers...)
+
+	sizes := func(opts ...InspectOpt) []int64 {
+		t.Helper()
+		details, err := cs.Inspect("test/img:latest", opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(details.Manifests) != 1 || !details.Manifests[0].Available {
+			t.Fatalf("unexpected manifests %+v", details.Manifests)
+		}
+		var s []int64
+		for _, l := range details.Manifests[0].Layers {
+			s = append(s, l.UncompressedSize)
+		}
+		return s
+	}
+
+	// Unknown unless decompressing the layers
+	if got := sizes(); len(got) != 2 || got[0] != -1 || got[1] != -1 {
+		t.Errorf("expected unknown sizes, got %v", got)
+	}
+	if got := sizes(WithInspectDecompress()); got[0] != int64(len(tarLayer(t, layers[0]))) || got[1] != int64(len(tarLayer(t, layers[1]))) {
+		t.Errorf("expected the size of the decompressed layers, got %v", got)
+	}
+
+	// Uncompressed content referenced from the layer labels
+	details, err := cs.Inspect("test/img:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := details.Manifests[0].Layers[0].Descriptor
+	tarball := tarLayer(t, layers[0])
+	udesc := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayer, Digest: digest.FromBytes(tarball), Size: int64(len(tarball))}
+	store := cs.cli.ContentStore()
+	if err = content.WriteBlob(cs.ctx, store, "uncompressed", bytes.NewReader(tarball), udesc); err != nil {
+		t.Fatal(err)
+	}
+	info := content.Info{Digest: layer.Digest, Labels: map[string]string{labels.LabelUncompressed: udesc.Digest.String()}}
+	if _, err = store.Update(cs.ctx, info, "labels."+labels.LabelUncompressed); err != nil {
+		t.Fatal(err)
+	}
+	if got := sizes(); got[0] != udesc.Size || got[1] != -1 {
+		t.Errorf("expected the size of the uncompressed content for the first layer only, got %v", got)
+	}
+
+	// Unpacked layers report the disk usage of their snapshot
+	img, err := cs.Get("test/img:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cs.Unpack(img); err != nil {
+		t.Fatal(err)
+	}
+	if got := sizes(); got[1] < 16384 {
+		t.Errorf("expected the disk usage of the unpacked layer, got %v", got)
+	}
+}
+
+func TestInspectNonImageManifests(t *testing.T) {
+	cs := newTestStore(t, t.TempDir())
+	img := importTestImage(t, cs, "test/img:latest", testLayer{"file": "data"})
+	ctx, done, err := cs.withLease(cs.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer done(ctx)
+
+	store := cs.cli.ContentStore()
+	writeJSON := func(mediaType string, v any) ocispec.Descriptor {
+		t.Helper()
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		desc := ocispec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(data), Size: int64(len(data))}
+		if err = content.WriteBlob(ctx, store, desc.Digest.String(), bytes.NewReader(data), desc); err != nil {
+			t.Fatal(err)
+		}
+		return desc
+	}
+	manifest := func(config ocispec.Descriptor, layers ...ocispec.Descriptor) ocispec.Descriptor {
+		return writeJSON(ocispec.MediaTypeImageManifest, ocispec.Manifest{
+			Versioned: specs.Versioned{SchemaVersion: 2},
+			MediaType: ocispec.MediaTypeImageManifest,
+			Config:    config,
+			Layers:    layers,
+		})
+	}
+
+	// An attestation manifest as built by buildx, with an image config and in-toto layers
+	statement := writeJSON("application/vnd.in-toto+json", map[string]string{"_type": "https://in-toto.io/Statement/v0.1"})
+	attestationConfig := writeJSON(ocispec.MediaTypeImageConfig, ocispec.Image{
+		Platform: ocispec.Platform{OS: "unknown", Architecture: "unknown"},
+		RootFS:   ocispec.RootFS{Type: "layers", DiffIDs: []digest.Digest{statement.Digest}},
+	})
+	attestation := manifest(attestationConfig, statement)
+	attestation.Platform = &ocispec.Platform{OS: "unknown", Architecture: "unknown"}
+	attestation.Annotations = map[string]string{
+		"vnd.docker.reference.type":   "attestation-manifest",
+		"vnd.docker.reference.digest": img.Target.Digest.String(),
+	}
+	// An artifact manifest with a config of its own
+	artifact := manifest(writeJSON("application/vnd.example.config+json", map[string]string{}), statement)
+	// An image config not matching the layers of its manifest
+	mismatched := manifest(writeJSON(ocispec.MediaTypeImageConfig, ocispec.Image{RootFS: ocispec.RootFS{Type: "layers"}}), statement)
+
+	imageDesc := img.Target
+	imageDesc.Platform = &ocispec.Platform{OS: "linux", Architecture: "amd64"}
+	index := writeJSON(ocispec.MediaTypeImageIndex, ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: []ocispec.Descriptor{imageDesc, attestation, artifact, mismatched},
+	})
+	if _, err = cs.Create(images.Image{Name: "test/attested:latest", Target: index}); err != nil {
+		t.Fatal(err)
+	}
+
+	details, err := cs.Inspect("test/attested:latest")
+	if err != nil {
+		t.Fatalf("failed to inspect image with non-image manifests: %v", err)
+	}
+	if len(details.Manifests) != 4 {
+		t.Fatalf("expected 4 manifests, got %d", len(details.Manifests))
+	}
+	if md := details.Manifests[0]; md.NonImage || len(md.Layers) != 1 || md.ChainID == "" {
+		t.Errorf("expected the image manifest to be described, got %+v", md)
+	}
+	for _, md := range details.Manifests[1:] {
+		if !md.Available || !md.NonImage || len(md.Layers) > 0 || md.ChainID != "" {
+			t.Errorf("expected manifest '%s' to be marked as not an image, got %+v", md.Descriptor.Digest, md)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/leases"
+	"github.com/containerd/errdefs"
+	bolt "go.etcd.io/bbolt"
+)
+
+// labelGCExpire is the lease label holding its expiration time, see containerd garbage collector
+const labelGCExpire = "containerd.io/gc.expire"
+
+// LeaseInfo describes a lease and the resources it keeps alive
+type LeaseInfo struct {
+	leases.Lease
+	// Expires is the expiration time of the lease, zero if it never expires
+	Expires   time.Time
+	Resources []leases.Resource
+}
+
+// Expired checks whether the lease expired and will be removed on next garbage collection
+func (l LeaseInfo) Expired() bool {
+	return !l.Expires.IsZero() && time.Now().After(l.Expires)
+}
+
+// ListLeases lists the leases of the store namespace matching the given containerd filters
+func (c *OCIStore) ListLeases(filters ...string) ([]LeaseInfo, error) {
+	release, err := c.startOp()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	ls, err := c.listLeases(c.ctx, filters...)
+	if err != nil {
+		c.log.Errorf("failed to list leases: %v", err)
+		return nil, err
+	}
+	return ls, nil
+}
+
+// GetLease returns the lease with the given ID
+func (c *OCIStore) GetLease(id string) (LeaseInfo, error) {
+	release, err := c.startOp()
+	if err != nil {
+		return LeaseInfo{}, err
+	}
+	defer release()
+
+	return c.getLease(c.ctx, id)
+}
+
+// DeleteLease removes the given lease, the resources it referenced are released on next
+// garbage collection
+func (c *OCIStore) DeleteLease(id string) (retErr error) {
+	release, err := c.startWriteOp()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	defer func() {
+		if retErr == nil {
+			c.autoGC()
+		}
+	}()
+
+	err = c.cli.LeasesService().Delete(c.ctx, leases.Lease{ID: id})
+	if errdefs.IsNotFound(err) {
+		return fmt.Errorf("lease '%s': %w", id, errdefs.ErrNotFound)
+	} else if err != nil {
+		c.log.Errorf("failed deleting lease '%s': %v", id, err)
+		return err
+	}
+
+	c.log.Infof("Successfully deleted lease '%s'", id)
+	return nil
+}
+
+// ExtendLease sets the expiration of the given lease to the given duration from now. Leases
+// without expiration can't be extended.
+func (c *OCIStore) ExtendLease(id string, duration time.Duration) (_ LeaseInfo, retErr error) {
+	release, err := c.startWriteOp()
+	if err != nil {
+		return LeaseInfo{}, err
+	}
+	defer release()
+
+	if duration <= 0 {
+		return LeaseInfo{}, fmt.Errorf("invalid lease duration '%s': %w", duration, errdefs.ErrInvalidArgument)
+	}
+
+	// The lease manager does not support updates, labels are set directly in the metadata database
+	expires := time.Now().Add(duration).UTC()
+	err = c.db.Update(func(tx *bolt.Tx) error {
+		bkt := nestedBucket(tx.Bucket([]byte("v1")), c.namespace, "leases", id)
+		if bkt == nil {
+			return fmt.Errorf("lease '%s': %w", id, errdefs.ErrNotFound)
+		}
+		lbkt := bkt.Bucket([]byte("labels"))
+		if lbkt == nil || lbkt.Get([]byte(labelGCExpire)) == nil {
+			return fmt.Errorf("lease '%s' does not expire: %w", id, errdefs.ErrFailedPrecondition)
+		}
+		return lbkt.Put([]byte(labelGCExpire), []byte(expires.Format(time.RFC3339)))
+	})
+	if err != nil {
+		c.log.Errorf("failed extending lease '%s': %v", id, err)
+		return LeaseInfo{}, err
+	}
+
+	c.log.Infof("Successfully extended lease '%s' until %s", id, expires.Format(time.RFC3339))
+	return c.getLease(c.ctx, id)
+}
+
+func (c *OCIStore) getLease(ctx context.Context, id string) (LeaseInfo, error) {
+	ls, err := c.listLeases(ctx, fmt.Sprintf("id==%q", id))
+	if err != nil {
+		return LeaseInfo{}, err
+	}
+	if len(ls) == 0 {
+		return LeaseInfo{}, fmt.Errorf("lease '%s': %w", id, errdefs.ErrNotFound)
+	}
+	return ls[0], nil
+}
+
+func (c *OCIStore) listLeases(ctx context.Context, filters ...string) ([]LeaseInfo, error) {
+	lm := c.cli.LeasesService()
+	ls, err := lm.List(ctx, filters...)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]LeaseInfo, 0, len(ls))
+	for _, l := range ls {
+		info := LeaseInfo{Lease: l}
+		if exp, ok := l.Labels[labelGCExpire]; ok {
+			info.Expires, err = time.Parse(time.RFC3339, exp)
+			if err != nil {
+				c.log.Warnf("invalid expiration '%s' of lease '%s': %v", exp, l.ID, err)
+			}
+		}
+		info.Resources, err = lm.ListResources(ctx, l)
+		if err != nil {
+			return nil, fmt.Errorf("failed listing resources of lease '%s': %w", l.ID, err)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
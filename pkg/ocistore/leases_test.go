@@ -0,0 +1,82 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/leases"
+	"github.com/containerd/errdefs"
+)
+
+func TestLeaseExpiration(t *testing.T) {
+	cs := newTestStore(t, t.TempDir())
+	lm := cs.cli.LeasesService()
+	past := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+
+	for _, opts := range [][]leases.Opt{
+		{leases.WithID("short"), leases.WithExpiration(time.Hour)},
+		{leases.WithID("expired"), leases.WithLabels(map[string]string{labelGCExpire: past})},
+		{leases.WithID("forever")},
+	} {
+		if _, err := lm.Create(cs.ctx, opts...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l, err := cs.ExtendLease("short", 2*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Expired() || time.Until(l.Expires) < 119*time.Minute {
+		t.Errorf("expected lease to expire in 2h, expires at %s", l.Expires)
+	}
+	if _, err = cs.ExtendLease("forever", time.Hour); !errdefs.IsFailedPrecondition(err) {
+		t.Errorf("expected leases without expiration not to be extended, got: %v", err)
+	}
+	if _, err = cs.ExtendLease("missing", time.Hour); !errdefs.IsNotFound(err) {
+		t.Errorf("expected a not found error, got: %v", err)
+	}
+	if _, err = cs.ExtendLease("short", 0); !errdefs.IsInvalidArgument(err) {
+		t.Errorf("expected an invalid argument error, got: %v", err)
+	}
+
+	l, err = cs.GetLease("expired")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.Expired() {
+		t.Errorf("expected lease to be expired, expires at %s", l.Expires)
+	}
+
+	// Only expired leases are collected
+	report, err := cs.GarbageCollect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Leases) != 1 || report.Leases[0] != (GCLease{Namespace: DefaultNamespace, ID: "expired"}) {
+		t.Errorf("expected only the expired lease to be collected, got %v", report.Leases)
+	}
+	ls, err := cs.ListLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 2 {
+		t.Errorf("expected 2 leases left, got %d", len(ls))
+	}
+}
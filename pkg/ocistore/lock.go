@@ -0,0 +1,383 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Store locking works as follows:
+//   - Writers hold an exclusive flock on the store lock file for their entire lifetime and record
+//     their PID in it. Once locked, writers publish a consistent copy of the metadata databases
+//     (a shared generation) and refresh it after every mutating operation.
+//   - Shared readers never take bolt locks on the live databases. They work on a private copy of
+//     the databases, taken from the live files if no writer holds the store or from the latest
+//     shared generation otherwise. Snapshot data is linked from the private copy, so readers
+//     neither block writers nor are blocked by them.
+//   - Shared readers hold an exclusive flock on a lock file of their private folder while alive.
+//     Writers remove the private folders left behind by readers that crashed when taking the lock.
+
+const (
+	lockFile      = "ocistore.lock"
+	sharedDir     = "shared"
+	sharedCurrent = "current"
+	sharedGenPfx  = "gen-"
+	sharedRdrPfx  = "reader-"
+	lockRetry     = 50 * time.Millisecond
+	// staleReaderAge is how old a private folder not locked by its reader must be to remove it
+	staleReaderAge = time.Minute
+
+	DefaultLockTimeout = 10 * time.Second
+)
+
+// StoreBusyError is returned when the store lock could not be acquired within the configured timeout
+type StoreBusyError struct {
+	PID int
+}
+
+func (e *StoreBusyError) Error() string {
+	if e.PID > 0 {
+		return fmt.Sprintf("store busy, held by PID %d", e.PID)
+	}
+	return "store busy, held by another process"
+}
+
+type storeLock struct {
+	f         *os.File
+	exclusive bool
+}
+
+// acquireLock takes the store lock, retrying until the given timeout expires. A zero timeout
+// does a single attempt. Exclusive locks record the PID of the current process in the lock file.
+func acquireLock(root string, exclusive bool, timeout time.Duration) (*storeLock, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(root, lockFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	flag := syscall.LOCK_SH | syscall.LOCK_NB
+	if exclusive {
+		flag = syscall.LOCK_EX | syscall.LOCK_NB
+	}
+
+	start := time.Now()
+	for {
+		err = syscall.Flock(int(f.Fd()), flag)
+		if err == nil {
+			break
+		}
+		if err != syscall.EWOULDBLOCK {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock store: %w", err)
+		}
+		if time.Since(start) >= timeout {
+			pid := readLockPID(f)
+			f.Close()
+			return nil, &StoreBusyError{PID: pid}
+		}
+		time.Sleep(lockRetry)
+	}
+
+	l := &storeLock{f: f, exclusive: exclusive}
+	if exclusive {
+		if err = l.f.Truncate(0); err == nil {
+			_, err = l.f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+		}
+		if err != nil {
+			l.release()
+			return nil, fmt.Errorf("failed to record lock holder: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// lockHolder returns the PID recorded in the store lock file, if any
+func lockHolder(root string) int {
+	f, err := os.Open(filepath.Join(root, lockFile))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	return readLockPID(f)
+}
+
+func readLockPID(f *os.File) int {
+	b := make([]byte, 32)
+	n, _ := f.ReadAt(b, 0)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b[:n])))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// release unlocks the store, exclusive locks clear the recorded PID before unlocking
+func (l *storeLock) release() error {
+	if l.exclusive {
+		_ = l.f.Truncate(0)
+	}
+	err := syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+	return errors.Join(err, l.f.Close())
+}
+
+// sweepStaleReaders removes the private folders of the shared readers of the store that are gone
+func sweepStaleReaders(root string) error {
+	dir := filepath.Join(root, sharedDir)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), sharedRdrPfx) {
+			continue
+		}
+		if rdr := filepath.Join(dir, e.Name()); readerGone(rdr) {
+			errs = append(errs, os.RemoveAll(rdr))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// readerGone checks whether the shared reader owning the given private folder is gone. Readers
+// lock their folder right after creating it, so folders not locked yet are only considered gone
+// once older than staleReaderAge.
+func readerGone(dir string) bool {
+	if lockHolder(dir) == 0 {
+		fi, err := os.Stat(dir)
+		return err == nil && time.Since(fi.ModTime()) > staleReaderAge
+	}
+	l, err := acquireLock(dir, false, 0)
+	if err != nil {
+		return false
+	}
+	_ = l.release()
+	return true
+}
+
+// publishShared writes a new shared generation of the metadata databases and points the current
+// link to it. Older generations are removed except the previous one, which readers may still be
+// copying from. It must be called with no operation in flight, as the snapshotter database is
+// copied as a plain file.
+func (c *OCIStore) publishShared() error {
+	dir := filepath.Join(c.root, sharedDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	gen, err := os.MkdirTemp(dir, sharedGenPfx)
+	if err != nil {
+		return err
+	}
+
+	err = c.bdb.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(filepath.Join(gen, boltDbFile), 0644)
+	})
+	if err == nil {
+		err = copyFile(filepath.Join(c.snapshotterRoot(), boltDbFile), filepath.Join(gen, snapshotsDir+".db"))
+	}
+	if err != nil {
+		os.RemoveAll(gen)
+		return err
+	}
+
+	current := filepath.Join(dir, sharedCurrent)
+	previous, _ := os.Readlink(current)
+
+	tmpLink := current + ".tmp"
+	_ = os.Remove(tmpLink)
+	if err = os.Symlink(filepath.Base(gen), tmpLink); err == nil {
+		err = os.Rename(tmpLink, current)
+	}
+	if err != nil {
+		os.RemoveAll(gen)
+		return err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, sharedGenPfx) && name != filepath.Base(gen) && name != previous {
+			_ = os.RemoveAll(filepath.Join(dir, name))
+		}
+	}
+	return nil
+}
+
+// publishIfDirty refreshes the shared generation if the metadata changed since it was last
+// published. It is a noop for shared readers or if there are other operations in flight,
+// as the last of them to finish publishes it.
+func (c *OCIStore) publishIfDirty() {
+	if !c.opsL.TryLock() {
+		return
+	}
+	defer c.opsL.Unlock()
+
+	if !c.IsInitiated() || c.lock == nil || !c.dirty.Swap(false) {
+		return
+	}
+	if err := c.publishShared(); err != nil {
+		c.log.Warnf("failed to publish metadata for shared readers: %v", err)
+	}
+}
+
+// openSharedView prepares a private copy of the store metadata for a shared reader inside the
+// given directory. It returns the metadata database path and the snapshotter root to use.
+func (c *OCIStore) openSharedView(priv string) (string, string, error) {
+	dbFile := filepath.Join(priv, boltDbFile)
+	snRoot := filepath.Join(priv, filepath.Base(c.snapshotterRoot()))
+	snDbFile := filepath.Join(snRoot, boltDbFile)
+
+	if err := os.MkdirAll(snRoot, 0700); err != nil {
+		return "", "", err
+	}
+
+	copyLive := func() error {
+		if err := copyFile(filepath.Join(c.root, boltDbFile), dbFile); err != nil {
+			return err
+		}
+		return copyFile(filepath.Join(c.snapshotterRoot(), boltDbFile), snDbFile)
+	}
+
+	copyShared := func() error {
+		dir := filepath.Join(c.root, sharedDir)
+		gen, err := os.Readlink(filepath.Join(dir, sharedCurrent))
+		if err != nil {
+			return err
+		}
+		if err = copyFile(filepath.Join(dir, gen, boltDbFile), dbFile); err != nil {
+			return err
+		}
+		return copyFile(filepath.Join(dir, gen, snapshotsDir+".db"), snDbFile)
+	}
+
+	// No writer holds the store, the live databases can be safely copied
+	lock, err := acquireLock(c.root, false, 0)
+	if err == nil {
+		err = errors.Join(copyLive(), lock.release())
+	} else {
+		var busy *StoreBusyError
+		if !errors.As(err, &busy) {
+			return "", "", err
+		}
+
+		// A writer holds the store, copy its latest shared generation. Retry once in case
+		// the writer rotated generations while copying.
+		if err = copyShared(); err != nil && errors.Is(err, os.ErrNotExist) {
+			err = copyShared()
+		}
+		if err != nil && errors.Is(err, os.ErrNotExist) {
+			// No shared generation available, wait for the writer to finish
+			lock, err = acquireLock(c.root, false, c.lockTimeout)
+			if err != nil {
+				return "", "", err
+			}
+			err = errors.Join(copyLive(), lock.release())
+		}
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	if err = linkSnapshotterData(c.snapshotterRoot(), snRoot); err != nil {
+		return "", "", err
+	}
+	return dbFile, snRoot, nil
+}
+
+// linkSnapshotterData links snapshots data of the store snapshotter root into the private one.
+// Top level folders are recreated and each of their entries linked, so snapshots created by a
+// reader are kept in its private folder and never written into the store.
+func linkSnapshotterData(src, dst string) error {
+	entries, err := os.ReadDir(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if e.Name() == boltDbFile {
+			continue
+		}
+		if !e.IsDir() {
+			if err = os.Symlink(filepath.Join(src, e.Name()), filepath.Join(dst, e.Name())); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = os.MkdirAll(filepath.Join(dst, e.Name()), 0700); err != nil {
+			return err
+		}
+		children, err := os.ReadDir(filepath.Join(src, e.Name()))
+		if err != nil {
+			return err
+		}
+		for _, ch := range children {
+			err = os.Symlink(filepath.Join(src, e.Name(), ch.Name()), filepath.Join(dst, e.Name(), ch.Name()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// copyFile copies src into dst, a missing src is not an error as databases are created lazily
+func copyFile(src, dst string) (retErr error) {
+	in, err := os.Open(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := out.Close()
+		if err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	_, err = io.Copy(out, in)
+	return err
+}
@@ -0,0 +1,332 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidcassany/ocistore/pkg/logger"
+)
+
+const (
+	helperEnv     = "OCISTORE_TEST_HELPER"
+	helperRootEnv = "OCISTORE_TEST_ROOT"
+
+	// Helper process modes
+	helperWriter        = "writer"
+	helperReader        = "reader"
+	helperCrashedReader = "crashed-reader"
+)
+
+// helperProcess is a store opened by another process, driven through its standard input
+type helperProcess struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	out   *bufio.Reader
+}
+
+// startHelper runs the test binary as a helper process opening the store in root with the given
+// mode and waits until the store is initiated
+func startHelper(t *testing.T, mode, root string) *helperProcess {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), helperEnv+"="+mode, helperRootEnv+"="+root)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	h := &helperProcess{cmd: cmd, stdin: stdin, out: bufio.NewReader(stdout)}
+	t.Cleanup(func() {
+		_ = h.stdin.Close()
+		_ = h.cmd.Wait()
+	})
+	h.expect(t, "ready")
+	return h
+}
+
+// send writes a command to the helper and waits for its acknowledgement
+func (h *helperProcess) send(t *testing.T, command string) {
+	t.Helper()
+	if _, err := fmt.Fprintln(h.stdin, command); err != nil {
+		t.Fatal(err)
+	}
+	h.expect(t, "ok")
+}
+
+func (h *helperProcess) expect(t *testing.T, want string) {
+	t.Helper()
+	line, err := h.out.ReadString('\n')
+	if err != nil {
+		t.Fatalf("helper process did not answer '%s': %v", want, err)
+	}
+	if got := strings.TrimSpace(line); got != want {
+		t.Fatalf("expected '%s' from helper process, got '%s'", want, got)
+	}
+}
+
+// stop closes the store of the helper and waits for it to exit
+func (h *helperProcess) stop(t *testing.T) {
+	t.Helper()
+	_ = h.stdin.Close()
+	if err := h.cmd.Wait(); err != nil {
+		t.Fatalf("helper process failed: %v", err)
+	}
+}
+
+// runHelper is the main function of helper processes. Writers tag the 'test/img:base' image
+// as 'test/img:<arg>' on every 'tag <arg>' command. The store is closed once stdin is closed,
+// except for crashed readers which exit right away without cleaning up.
+func runHelper(mode string) int {
+	log, _ := logger.NewLogger(logger.ErrorLevel)
+	opts := []StoreOpt{WithDriver(NativeDriver)}
+	if mode != helperWriter {
+		opts = append(opts, WithSharedAccess())
+	}
+	cs := NewOCIStore(log, os.Getenv(helperRootEnv), opts...)
+	if err := cs.Init(context.Background()); err != nil {
+		fmt.Fprintf(os.Stderr, "helper failed to init store: %v\n", err)
+		return 1
+	}
+	fmt.Println("ready")
+	if mode == helperCrashedReader {
+		return 0
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if tag, ok := strings.CutPrefix(scanner.Text(), "tag "); ok {
+			if _, err := cs.Tag("test/img:base", "test/img:"+tag, false); err != nil {
+				fmt.Fprintf(os.Stderr, "helper failed to tag image: %v\n", err)
+				return 1
+			}
+		}
+		fmt.Println("ok")
+	}
+	if err := cs.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "helper failed to close store: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// prepareLockTestStore creates a store holding the 'test/img:base' image
+func prepareLockTestStore(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	cs := newTestStore(t, root)
+	importTestImage(t, cs, "test/img:base", testLayer{"file": "base"})
+	if err := cs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestLockBusy(t *testing.T) {
+	root := prepareLockTestStore(t)
+	writer := startHelper(t, helperWriter, root)
+
+	cs := NewOCIStore(testLogger(t), root, WithDriver(NativeDriver), WithLockTimeout(300*time.Millisecond))
+	start := time.Now()
+	err := cs.Init(context.Background())
+	if err == nil {
+		cs.Close()
+		t.Fatal("expected the store to be busy")
+	}
+	if waited := time.Since(start); waited < 300*time.Millisecond {
+		t.Errorf("expected to wait for the lock timeout, failed after %s", waited)
+	}
+
+	var busy *StoreBusyError
+	if !errors.As(err, &busy) {
+		t.Fatalf("expected a StoreBusyError, got: %v", err)
+	}
+	pid := writer.cmd.Process.Pid
+	if busy.PID != pid {
+		t.Errorf("expected the lock to be held by PID %d, got %d", pid, busy.PID)
+	}
+	if want := fmt.Sprintf("held by PID %d", pid); !strings.Contains(err.Error(), want) {
+		t.Errorf("expected error '%v' to contain '%s'", err, want)
+	}
+
+	// The lock is released as soon as the writer is done
+	writer.stop(t)
+	newTestStore(t, root)
+}
+
+func TestSharedReadersDuringPublish(t *testing.T) {
+	root := prepareLockTestStore(t)
+	writer := startHelper(t, helperWriter, root)
+
+	const tags = 20
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < tags; i++ {
+			writer.send(t, fmt.Sprintf("tag %d", i))
+		}
+	}()
+
+	// Every reader sees a consistent generation, never older than the one of the former reader
+	seen := 0
+	for i := 0; i < tags; i++ {
+		reader := newTestStore(t, root, WithSharedAccess(), WithLockTimeout(time.Second))
+		imgs, err := reader.List()
+		if err != nil {
+			t.Fatalf("shared reader failed to list images: %v", err)
+		}
+		if len(imgs) < seen || len(imgs) < 1 {
+			t.Fatalf("shared reader saw %d images, after a former reader saw %d", len(imgs), seen)
+		}
+		seen = len(imgs)
+		if _, err = reader.Get("test/img:base"); err != nil {
+			t.Fatalf("shared reader failed to get base image: %v", err)
+		}
+		if err = reader.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	// Readers opened once the last change is published see all of them
+	reader := newTestStore(t, root, WithSharedAccess())
+	imgs, err := reader.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imgs) != tags+1 {
+		t.Errorf("expected %d images, got %d", tags+1, len(imgs))
+	}
+	writer.stop(t)
+}
+
+func TestSharedGenerationCleanup(t *testing.T) {
+	root := prepareLockTestStore(t)
+	cs := newTestStore(t, root)
+
+	for i := 0; i < 5; i++ {
+		if _, err := cs.Tag("test/img:base", fmt.Sprintf("test/img:%d", i), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := filepath.Join(root, sharedDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gens []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), sharedGenPfx) {
+			gens = append(gens, e.Name())
+		}
+	}
+	if len(gens) > 2 {
+		t.Errorf("expected at most the current and previous generations, got %v", gens)
+	}
+	current, err := os.Readlink(filepath.Join(dir, sharedCurrent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, current, boltDbFile)); err != nil {
+		t.Errorf("current generation '%s' is not complete: %v", current, err)
+	}
+
+	// The writer holds the store, readers copy the current generation
+	reader := newTestStore(t, root, WithSharedAccess())
+	if _, err = reader.Get("test/img:4"); err != nil {
+		t.Errorf("shared reader does not see the last published change: %v", err)
+	}
+}
+
+func TestStaleReadersSweep(t *testing.T) {
+	root := prepareLockTestStore(t)
+
+	startHelper(t, helperCrashedReader, root).stop(t)
+	live := startHelper(t, helperReader, root)
+
+	dir := filepath.Join(root, sharedDir)
+	readers := func() []string {
+		t.Helper()
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), sharedRdrPfx) {
+				names = append(names, e.Name())
+			}
+		}
+		return names
+	}
+	if n := len(readers()); n != 2 {
+		t.Fatalf("expected the folders of the crashed and live readers, got %d", n)
+	}
+	liveDir := ""
+	for _, name := range readers() {
+		if lockHolder(filepath.Join(dir, name)) == live.cmd.Process.Pid {
+			liveDir = name
+		}
+	}
+	if liveDir == "" {
+		t.Fatal("live reader folder not found")
+	}
+
+	// Folders not locked yet are only removed once old enough
+	fresh := filepath.Join(dir, sharedRdrPfx+"fresh")
+	old := filepath.Join(dir, sharedRdrPfx+"old")
+	for _, d := range []string{fresh, old} {
+		if err := os.Mkdir(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	past := time.Now().Add(-2 * staleReaderAge)
+	if err := os.Chtimes(old, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	newTestStore(t, root)
+	got := readers()
+	want := []string{liveDir, filepath.Base(fresh)}
+	sort.Strings(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("expected remaining reader folders %v, got %v", want, got)
+	}
+	live.stop(t)
+}
@@ -17,7 +17,6 @@ limitations under the License.
 package ocistore
 
 import (
-	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -27,13 +26,16 @@ import (
 	"github.com/containerd/containerd/v2/core/mount"
 	"github.com/containerd/containerd/v2/core/snapshots"
 	"github.com/containerd/errdefs"
+	"github.com/containerd/platforms"
 	"github.com/opencontainers/image-spec/identity"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 type MountOpts struct {
-	sOpts  []snapshots.Opt
-	aOpts  []ApplyCommitOpt
-	unpack bool
+	sOpts    []snapshots.Opt
+	aOpts    []ApplyCommitOpt
+	platform *ocispec.Platform
+	unpack   bool
 }
 
 type MountOpt func(*MountOpts) error
@@ -52,6 +54,14 @@ func WithMountSnapshotOpts(opts ...snapshots.Opt) MountOpt {
 	}
 }
 
+// WithMountPlatform sets the platform of the image to mount, defaults to the store platform
+func WithMountPlatform(platform ocispec.Platform) MountOpt {
+	return func(mOpts *MountOpts) error {
+		mOpts.platform = &platform
+		return nil
+	}
+}
+
 func WithMountApplyCommitOpts(opts ...ApplyCommitOpt) MountOpt {
 	return func(mOpts *MountOpts) error {
 		mOpts.aOpts = append(mOpts.aOpts, opts...)
@@ -59,14 +69,16 @@ func WithMountApplyCommitOpts(opts ...ApplyCommitOpt) MountOpt {
 	}
 }
 
-func (c *OCIStore) MountFromScratch(target string, key string) (string, error) {
-	return c.Mount(nil, target, key, false)
+func (c *OCIStore) MountFromScratch(target string, key string, opts ...MountOpt) (string, error) {
+	return c.Mount(nil, target, key, false, opts...)
 }
 
 func (c *OCIStore) Mount(img client.Image, target string, key string, readonly bool, opts ...MountOpt) (snapshotKey string, retErr error) {
-	if !c.IsInitiated() {
-		return "", errors.New(missInitErrMsg)
+	release, err := c.startOp()
+	if err != nil {
+		return "", err
 	}
+	defer release()
 
 	mOpt := &MountOpts{
 		aOpts: []ApplyCommitOpt{},
@@ -79,15 +91,25 @@ func (c *OCIStore) Mount(img client.Image, target string, key string, readonly b
 		}
 	}
 
+	if c.isReadOnly() && (!readonly || mOpt.unpack) {
+		return "", ErrReadOnly
+	}
+
+	aOpts := mOpt.aOpts
+	if mOpt.platform != nil && img != nil {
+		img = client.NewImageWithPlatform(c.cli, img.Metadata(), platforms.OnlyStrict(*mOpt.platform))
+		aOpts = append([]ApplyCommitOpt{WithUnpackPlatform(*mOpt.platform)}, aOpts...)
+	}
+
 	if key == "" {
 		// TODO there is probably a better scheme, is target needed at all?
 		key = uniquePart() + "-" + strings.ReplaceAll(strings.Trim(target, "/"), "/", "-")
 	}
 
 	// TODO handle lease properly, whats the purpose of this setup?
-	ctx, done, err := c.cli.WithLease(c.ctx,
+	ctx, done, err := c.withLease(c.ctx,
 		leases.WithID(key),
-		leases.WithExpiration(24*time.Hour),
+		leases.WithExpiration(c.mountLease),
 		leases.WithLabel("containerd.io/gc.ref.snapshot."+c.driver, key),
 	)
 	if err != nil && !errdefs.IsAlreadyExists(err) {
@@ -103,7 +125,7 @@ func (c *OCIStore) Mount(img client.Image, target string, key string, readonly b
 	// TODO create and/or check target existence?
 
 	if mOpt.unpack {
-		err = c.unpack(ctx, img, mOpt.aOpts...)
+		err = c.unpack(ctx, img, aOpts...)
 		if err != nil {
 			c.log.Errorf("failed to unpack image '%s': %v", img.Name(), err)
 			return "", err
@@ -132,6 +154,17 @@ func (c *OCIStore) Mount(img client.Image, target string, key string, readonly b
 	}
 
 	sn := c.cli.SnapshotService(c.driver)
+	if c.readOnly {
+		// The metadata database can't be written, views are created directly on the driver
+		// which runs on a private copy of its own metadata
+		sn = c.snapshotters[c.driver]
+		if parent != "" {
+			parent, err = c.driverSnapshotKey(parent)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
 
 	sOpts := append(mOpt.sOpts, snapshots.WithLabels(labels))
 
@@ -147,7 +180,7 @@ func (c *OCIStore) Mount(img client.Image, target string, key string, readonly b
 			mounts, err = sn.Mounts(ctx, key)
 		}
 		if err != nil {
-			c.log.Errorf("failed to create an active commit for image '%s': %v", img.Name(), err)
+			c.log.Errorf("failed to create an active snapshot '%s': %v", key, err)
 			return "", err
 		}
 	}
@@ -156,28 +189,79 @@ func (c *OCIStore) Mount(img client.Image, target string, key string, readonly b
 		if err := sn.Remove(ctx, key); err != nil && !errdefs.IsNotFound(err) {
 			c.log.Errorf("error cleaning up snapshot after mount error: %v", err)
 		}
-		c.log.Errorf("failed to mount image '%s': %v", img.Name(), err)
+		c.log.Errorf("failed to mount snapshot '%s': %v", key, err)
 		return "", err
 	}
 
+	// Read-only stores can't keep track of their mounts
+	if !c.isReadOnly() {
+		info := MountInfo{Target: target, Key: key, ReadOnly: readonly, Created: time.Now()}
+		if img != nil {
+			info.Image = img.Name()
+		}
+		if err = c.addMount(info); err != nil {
+			c.log.Warnf("failed to record mount of '%s', its snapshot key is required to unmount: %v", target, err)
+		}
+	}
+
 	return key, nil
 }
 
+// Umount unmounts the given target, the snapshot key is looked up from the mount records if
+// not provided. removeSnap sets how many snapshots of the chain are removed, -1 removes all of them.
 func (c *OCIStore) Umount(target string, key string, removeSnap int) (retErr error) {
-	if !c.IsInitiated() {
-		return errors.New(missInitErrMsg)
+	release, err := c.startOp()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if removeSnap != 0 && c.shared {
+		return ErrReadOnly
+	}
+
+	if key == "" {
+		info, err := c.getMount(target)
+		if err != nil && !errdefs.IsNotFound(err) {
+			return err
+		} else if err != nil && removeSnap != 0 {
+			return fmt.Errorf("no mount recorded for '%s', the snapshot key is required to remove snapshots: %w", target, err)
+		}
+		key = info.Key
 	}
 
 	if err := mount.UnmountAll(target, 0); err != nil {
 		return err
 	}
 
+	if !c.isReadOnly() {
+		if err = c.removeMount(target); err != nil {
+			c.log.Warnf("failed to remove mount record of '%s': %v", target, err)
+		}
+	}
+
 	// Do not remove any snapshot
 	if removeSnap == 0 {
 		return nil
 	}
 
-	ctx, done, err := c.cli.WithLease(c.ctx)
+	// Views of read-only stores are not kept in the store, there is no lease nor chain to remove
+	if c.readOnly {
+		err = c.snapshotters[c.driver].Remove(c.ctx, key)
+		if err != nil && !errdefs.IsNotFound(err) {
+			return fmt.Errorf("error removing snapshot: %w", err)
+		}
+		return nil
+	}
+
+	// Deferred before the lease removal so it runs once the operation lease is gone
+	defer func() {
+		if retErr == nil {
+			c.autoGC()
+		}
+	}()
+
+	ctx, done, err := c.withLease(c.ctx)
 	if err != nil {
 		c.log.Errorf("failed to create lease to umount snapshot: %v", err)
 		return err
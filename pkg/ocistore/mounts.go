@@ -0,0 +1,221 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/containerd/errdefs"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Mounts are recorded in the metadata database next to the containerd buckets:
+//
+//	ocistore/v1/<namespace>/mounts/<target>/{key,image,readonly,created}
+const (
+	bucketOCIStore = "ocistore"
+	bucketVersion  = "v1"
+	bucketMounts   = "mounts"
+)
+
+// MountInfo describes a mount done by the store
+type MountInfo struct {
+	Target   string
+	Key      string
+	Image    string
+	ReadOnly bool
+	Created  time.Time
+}
+
+// ListMounts lists the mounts of the store namespace
+func (c *OCIStore) ListMounts() ([]MountInfo, error) {
+	release, err := c.startOp()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	mounts, err := c.listMountRecords()
+	if err != nil {
+		c.log.Errorf("failed to list mounts: %v", err)
+		return nil, err
+	}
+	return mounts, nil
+}
+
+// listMountRecords returns the mount records of the store namespace
+func (c *OCIStore) listMountRecords() ([]MountInfo, error) {
+	var mounts []MountInfo
+	err := c.bdb.View(func(tx *bolt.Tx) error {
+		bkt := c.mountsBucket(tx)
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			if v == nil {
+				mounts = append(mounts, readMountInfo(string(k), bkt.Bucket(k)))
+			}
+			return nil
+		})
+	})
+	return mounts, err
+}
+
+// GetMount returns the mount of the given target
+func (c *OCIStore) GetMount(target string) (MountInfo, error) {
+	release, err := c.startOp()
+	if err != nil {
+		return MountInfo{}, err
+	}
+	defer release()
+
+	return c.getMount(target)
+}
+
+func (c *OCIStore) getMount(target string) (MountInfo, error) {
+	var info MountInfo
+	err := c.bdb.View(func(tx *bolt.Tx) error {
+		for _, t := range targetKeys(target) {
+			if bkt := nestedBucket(c.mountsBucket(tx), t); bkt != nil {
+				info = readMountInfo(t, bkt)
+				return nil
+			}
+		}
+		return fmt.Errorf("mount '%s': %w", resolveTarget(target), errdefs.ErrNotFound)
+	})
+	return info, err
+}
+
+// addMount records the given mount, any former record of the same target is replaced
+func (c *OCIStore) addMount(info MountInfo) error {
+	target := resolveTarget(info.Target)
+
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bkt, err := createNestedBucket(tx, bucketOCIStore, bucketVersion, c.namespace, bucketMounts)
+		if err != nil {
+			return err
+		}
+		for _, t := range targetKeys(info.Target) {
+			if bkt.Bucket([]byte(t)) == nil {
+				continue
+			}
+			if err = bkt.DeleteBucket([]byte(t)); err != nil {
+				return err
+			}
+		}
+		mbkt, err := bkt.CreateBucket([]byte(target))
+		if err != nil {
+			return err
+		}
+
+		for k, v := range map[string]string{
+			"key":      info.Key,
+			"image":    info.Image,
+			"readonly": strconv.FormatBool(info.ReadOnly),
+			"created":  info.Created.UTC().Format(time.RFC3339Nano),
+		} {
+			if err = mbkt.Put([]byte(k), []byte(v)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// removeMount removes the record of the given target, if any
+func (c *OCIStore) removeMount(target string) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bkt := c.mountsBucket(tx)
+		if bkt == nil {
+			return nil
+		}
+		for _, t := range targetKeys(target) {
+			if bkt.Bucket([]byte(t)) == nil {
+				continue
+			}
+			if err := bkt.DeleteBucket([]byte(t)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// resolveTarget returns the absolute path of the given mount target with its symlinks resolved,
+// as listed in the system mount table. Targets that can't be resolved, e.g. because they no
+// longer exist, are only made absolute.
+func resolveTarget(target string) string {
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		return target
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	return abs
+}
+
+// targetKeys returns the keys the record of the given target can be stored with: its resolved
+// path and, for records stored before symlinks were resolved, its absolute path
+func targetKeys(target string) []string {
+	keys := []string{resolveTarget(target)}
+	if abs, err := filepath.Abs(target); err == nil && abs != keys[0] {
+		keys = append(keys, abs)
+	}
+	return keys
+}
+
+// removeNamespaceMounts removes the mount records of the given namespace
+func removeNamespaceMounts(tx *bolt.Tx, namespace string) error {
+	bkt := nestedBucket(tx.Bucket([]byte(bucketOCIStore)), bucketVersion)
+	if bkt == nil || bkt.Bucket([]byte(namespace)) == nil {
+		return nil
+	}
+	return bkt.DeleteBucket([]byte(namespace))
+}
+
+func (c *OCIStore) mountsBucket(tx *bolt.Tx) *bolt.Bucket {
+	return nestedBucket(tx.Bucket([]byte(bucketOCIStore)), bucketVersion, c.namespace, bucketMounts)
+}
+
+func readMountInfo(target string, bkt *bolt.Bucket) MountInfo {
+	info := MountInfo{
+		Target: target,
+		Key:    string(bkt.Get([]byte("key"))),
+		Image:  string(bkt.Get([]byte("image"))),
+	}
+	info.ReadOnly, _ = strconv.ParseBool(string(bkt.Get([]byte("readonly"))))
+	info.Created, _ = time.Parse(time.RFC3339Nano, string(bkt.Get([]byte("created"))))
+	return info
+}
+
+// createNestedBucket returns the bucket at the given path, creating any missing bucket
+func createNestedBucket(tx *bolt.Tx, keys ...string) (*bolt.Bucket, error) {
+	bkt, err := tx.CreateBucketIfNotExists([]byte(keys[0]))
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys[1:] {
+		if bkt, err = bkt.CreateBucketIfNotExists([]byte(k)); err != nil {
+			return nil, err
+		}
+	}
+	return bkt, nil
+}
@@ -0,0 +1,92 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd/v2/core/mount"
+	"github.com/containerd/errdefs"
+)
+
+// mountTestImage mounts the given image on a new target folder, it is unmounted at the end of
+// the test if still mounted
+func mountTestImage(t *testing.T, cs *OCIStore, name string, readonly bool, opts ...MountOpt) (string, string) {
+	t.Helper()
+	img, err := cs.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := t.TempDir()
+	key, err := cs.Mount(img, target, "", readonly, append([]MountOpt{WithMountUnpack()}, opts...)...)
+	if err != nil {
+		t.Fatalf("failed to mount '%s': %v", name, err)
+	}
+	t.Cleanup(func() { _ = mount.UnmountAll(target, 0) })
+	return target, key
+}
+
+func TestMountRecords(t *testing.T) {
+	requireRoot(t)
+	cs := newTestStore(t, t.TempDir())
+	importTestImage(t, cs, "test/img:latest", testLayer{"file": "data"})
+
+	target, key := mountTestImage(t, cs, "test/img:latest", true)
+	if data, err := os.ReadFile(filepath.Join(target, "file")); err != nil || string(data) != "data" {
+		t.Fatalf("unexpected mounted content '%s': %v", data, err)
+	}
+
+	info, err := cs.GetMount(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Key != key || info.Image != "test/img:latest" || !info.ReadOnly || info.Created.IsZero() {
+		t.Errorf("unexpected mount record %+v", info)
+	}
+
+	// Records are kept per namespace
+	if err = cs.CreateNamespace("other", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = cs.SetNamespace("other"); err != nil {
+		t.Fatal(err)
+	}
+	if ms, err := cs.ListMounts(); err != nil || len(ms) != 0 {
+		t.Errorf("expected no mounts in namespace 'other', got %v: %v", ms, err)
+	}
+	if err = cs.SetNamespace(DefaultNamespace); err != nil {
+		t.Fatal(err)
+	}
+
+	// The snapshot key is looked up from the record
+	if err = cs.Umount(target, "", -1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cs.GetMount(target); !errdefs.IsNotFound(err) {
+		t.Errorf("expected mount record to be removed, got: %v", err)
+	}
+	if _, err = cs.cli.SnapshotService(cs.driver).Stat(cs.ctx, key); !errdefs.IsNotFound(err) {
+		t.Errorf("expected snapshot '%s' to be removed, got: %v", key, err)
+	}
+
+	// Snapshots of unrecorded mounts can't be removed without their key
+	if err = cs.Umount(target, "", -1); !errdefs.IsNotFound(err) {
+		t.Errorf("expected a not found error, got: %v", err)
+	}
+}
@@ -0,0 +1,463 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/leases"
+	"github.com/containerd/containerd/v2/core/metadata"
+	"github.com/containerd/containerd/v2/core/metadata/boltutil"
+	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/containerd/v2/pkg/identifiers"
+	"github.com/containerd/containerd/v2/pkg/namespaces"
+	"github.com/containerd/errdefs"
+	bolt "go.etcd.io/bbolt"
+)
+
+// SetNamespace switches the namespace the store operates in. It waits for any in-flight
+// operation to finish, operations started afterwards run in the new namespace.
+func (c *OCIStore) SetNamespace(namespace string) error {
+	if err := identifiers.Validate(namespace); err != nil {
+		return fmt.Errorf("invalid namespace '%s': %w", namespace, err)
+	}
+
+	c.opsL.Lock()
+	defer c.opsL.Unlock()
+
+	c.namespace = namespace
+	if c.ctx != nil {
+		c.ctx = namespaces.WithNamespace(c.ctx, namespace)
+	}
+	return nil
+}
+
+// ListNamespaces returns all the namespaces of the store
+func (c *OCIStore) ListNamespaces() ([]string, error) {
+	release, err := c.startOp()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var nss []string
+	err = c.db.View(func(tx *bolt.Tx) error {
+		nss, err = metadata.NewNamespaceStore(tx).List(c.ctx)
+		return err
+	})
+	return nss, err
+}
+
+// GetNamespaceLabels returns the labels of the given namespace
+func (c *OCIStore) GetNamespaceLabels(namespace string) (map[string]string, error) {
+	release, err := c.startOp()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var labels map[string]string
+	err = c.db.View(func(tx *bolt.Tx) error {
+		labels, err = metadata.NewNamespaceStore(tx).Labels(c.ctx, namespace)
+		return err
+	})
+	return labels, err
+}
+
+// CreateNamespace creates a new namespace with the given labels
+func (c *OCIStore) CreateNamespace(namespace string, labels map[string]string) error {
+	release, err := c.startWriteOp()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	err = c.db.Update(func(tx *bolt.Tx) error {
+		return metadata.NewNamespaceStore(tx).Create(c.ctx, namespace, labels)
+	})
+	if err != nil {
+		c.log.Errorf("failed to create namespace '%s': %v", namespace, err)
+		return err
+	}
+
+	c.log.Infof("Successfully created namespace '%s'", namespace)
+	return nil
+}
+
+// RemoveNamespace removes the given namespace. Namespaces including images, snapshots or content
+// are only removed if force is set, in that case all of them are removed together with the
+// namespace leases and the garbage collector is run to release their disk space.
+func (c *OCIStore) RemoveNamespace(namespace string, force bool) error {
+	release, err := c.startWriteOp()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ctx := namespaces.WithNamespace(c.ctx, namespace)
+	if force {
+		if err = c.wipeNamespace(ctx); err != nil {
+			c.log.Errorf("failed to wipe namespace '%s': %v", namespace, err)
+			return err
+		}
+	}
+
+	err = c.db.Update(func(tx *bolt.Tx) error {
+		if err := metadata.NewNamespaceStore(tx).Delete(ctx, namespace); err != nil {
+			return err
+		}
+		return removeNamespaceMounts(tx, namespace)
+	})
+	if err != nil {
+		c.log.Errorf("failed to remove namespace '%s': %v", namespace, err)
+		return err
+	}
+
+	if force {
+		if _, err = c.garbageCollect(c.ctx, false); err != nil {
+			c.log.Warnf("failed to release data of namespace '%s': %v", namespace, err)
+		}
+	}
+
+	c.log.Infof("Successfully removed namespace '%s'", namespace)
+	return nil
+}
+
+// wipeNamespace removes all images, leases, snapshots and content of the namespace set in ctx
+func (c *OCIStore) wipeNamespace(ctx context.Context) error {
+	imgs, err := c.cli.ImageService().List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, img := range imgs {
+		if err = c.cli.ImageService().Delete(ctx, img.Name); err != nil && !errdefs.IsNotFound(err) {
+			return err
+		}
+	}
+
+	ls, err := c.cli.LeasesService().List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, l := range ls {
+		if err = c.cli.LeasesService().Delete(ctx, leases.Lease{ID: l.ID}); err != nil && !errdefs.IsNotFound(err) {
+			return err
+		}
+	}
+
+	for name, sn := range c.db.Snapshotters() {
+		if err = removeAllSnapshots(ctx, sn); err != nil {
+			return fmt.Errorf("failed to remove snapshots of '%s' driver: %w", name, err)
+		}
+	}
+
+	var dgsts []content.Info
+	err = c.cli.ContentStore().Walk(ctx, func(info content.Info) error {
+		dgsts = append(dgsts, info)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, info := range dgsts {
+		if err = c.cli.ContentStore().Delete(ctx, info.Digest); err != nil && !errdefs.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeAllSnapshots removes all snapshots, children are removed before their parents
+func removeAllSnapshots(ctx context.Context, sn snapshots.Snapshotter) error {
+	for {
+		infos, err := listSnapshots(ctx, sn)
+		if err != nil {
+			return err
+		}
+		if len(infos) == 0 {
+			return nil
+		}
+
+		var removed int
+		for _, info := range infos {
+			err = sn.Remove(ctx, info.Name)
+			if errdefs.IsFailedPrecondition(err) {
+				continue
+			} else if err != nil && !errdefs.IsNotFound(err) {
+				return err
+			}
+			removed++
+		}
+		if removed == 0 {
+			return errors.New("could not remove snapshots, all of them have children")
+		}
+	}
+}
+
+// The adoption of legacy snapshots runs once per driver, its completion is recorded next to the
+// mount records:
+//
+//	ocistore/migrations/adopt-snapshots.<driver>
+const (
+	bucketMigrations    = "migrations"
+	migrationAdoptSnPfx = "adopt-snapshots."
+)
+
+// adoptLegacySnapshots registers into the metadata database the driver snapshots not referenced
+// from any namespace. Snapshots used to be managed on the driver directly, without this they
+// would not be visible and the garbage collector would remove them. Snapshots are adopted by
+// the namespaces whose images or mount leases refer to them, others by the namespace set in ctx.
+// Once done it is recorded in the database, so it is not attempted again on later inits.
+// It returns the number of adopted snapshots.
+func adoptLegacySnapshots(ctx context.Context, bdb *bolt.DB, driver string, sn snapshots.Snapshotter) (int, error) {
+	ns, err := namespaces.NamespaceRequired(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var done bool
+	err = bdb.View(func(tx *bolt.Tx) error {
+		done = legacySnapshotsAdopted(tx, driver)
+		return nil
+	})
+	if err != nil || done {
+		return 0, err
+	}
+
+	// Drivers report not found until the first snapshot is created
+	infos, err := listSnapshots(ctx, sn)
+	if err != nil && !errdefs.IsNotFound(err) {
+		return 0, err
+	}
+
+	var adopted int
+	err = bdb.Update(func(tx *bolt.Tx) error {
+		if len(infos) > 0 {
+			if adopted, err = adoptUnreferencedSnapshots(tx, ns, driver, infos); err != nil {
+				return err
+			}
+		}
+		bkt, err := createNestedBucket(tx, bucketOCIStore, bucketMigrations)
+		if err != nil {
+			return err
+		}
+		return bkt.Put([]byte(migrationAdoptSnPfx+driver), []byte(time.Now().UTC().Format(time.RFC3339Nano)))
+	})
+	return adopted, err
+}
+
+// legacySnapshotsAdopted reports whether the legacy snapshots of the driver were already adopted
+func legacySnapshotsAdopted(tx *bolt.Tx, driver string) bool {
+	bkt := nestedBucket(tx.Bucket([]byte(bucketOCIStore)), bucketMigrations)
+	return bkt != nil && bkt.Get([]byte(migrationAdoptSnPfx+driver)) != nil
+}
+
+// adoptUnreferencedSnapshots adopts the given driver snapshots not referenced from any namespace,
+// see adoptLegacySnapshots. It returns the number of adopted snapshots.
+func adoptUnreferencedSnapshots(tx *bolt.Tx, ns, driver string, infos []snapshots.Info) (int, error) {
+	v1 := tx.Bucket([]byte("v1"))
+	if v1 == nil {
+		return 0, errors.New("metadata database is not initialized")
+	}
+
+	var nss []string
+	err := v1.ForEach(func(k, v []byte) error {
+		if v == nil {
+			nss = append(nss, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Driver keys referenced from any namespace
+	seen := map[string]bool{}
+	for _, n := range nss {
+		dbkt := nestedBucket(v1, n, "snapshots", driver)
+		if dbkt == nil {
+			continue
+		}
+		err = dbkt.ForEach(func(sk, sv []byte) error {
+			if sv == nil {
+				seen[string(dbkt.Bucket(sk).Get([]byte("name")))] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Unreferenced keys created by the metadata snapshotter (<namespace>/<id>/<key>) are
+	// leftovers of interrupted operations, those are left to the garbage collector
+	legacy := map[string]snapshots.Info{}
+	for _, info := range infos {
+		parts := strings.SplitN(info.Name, "/", 3)
+		if len(parts) == 3 {
+			if _, err := strconv.ParseUint(parts[1], 10, 64); err == nil {
+				continue
+			}
+		}
+		if !seen[info.Name] {
+			legacy[info.Name] = info
+		}
+	}
+	if len(legacy) == 0 {
+		return 0, nil
+	}
+
+	// Images refer to the top snapshot of their chain from the labels of their content,
+	// mount leases are named after their snapshot
+	owned := map[string]map[string]bool{}
+	assigned := map[string]bool{}
+	own := func(n, key string) {
+		for key != "" && legacy[key].Name != "" {
+			if owned[n] == nil {
+				owned[n] = map[string]bool{}
+			}
+			owned[n][key] = true
+			assigned[key] = true
+			key = legacy[key].Parent
+		}
+	}
+	for _, n := range nss {
+		if bbkt := nestedBucket(v1, n, "content", "blob"); bbkt != nil {
+			err = bbkt.ForEach(func(k, v []byte) error {
+				if lbkt := nestedBucket(bbkt, string(k), "labels"); v == nil && lbkt != nil {
+					own(n, string(lbkt.Get([]byte("containerd.io/gc.ref.snapshot."+driver))))
+				}
+				return nil
+			})
+			if err != nil {
+				return 0, err
+			}
+		}
+		if lbkt := nestedBucket(v1, n, "leases"); lbkt != nil {
+			err = lbkt.ForEach(func(k, v []byte) error {
+				if v == nil {
+					own(n, string(k))
+				}
+				return nil
+			})
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	for name := range legacy {
+		if !assigned[name] {
+			own(ns, name)
+		}
+	}
+
+	for n, keys := range owned {
+		if err = adoptSnapshots(v1, n, driver, legacy, keys); err != nil {
+			return 0, err
+		}
+	}
+	return len(legacy), nil
+}
+
+// adoptSnapshots writes the metadata of the given driver snapshots into the namespace. Snapshots
+// keep their driver key, so parents and leases still refer to them.
+func adoptSnapshots(v1 *bolt.Bucket, ns, driver string, infos map[string]snapshots.Info, keys map[string]bool) error {
+	nsbkt, err := v1.CreateBucketIfNotExists([]byte(ns))
+	if err != nil {
+		return err
+	}
+	snbkt, err := nsbkt.CreateBucketIfNotExists([]byte("snapshots"))
+	if err != nil {
+		return err
+	}
+	bkt, err := snbkt.CreateBucketIfNotExists([]byte(driver))
+	if err != nil {
+		return err
+	}
+
+	for key := range keys {
+		info := infos[key]
+		sbkt, err := bkt.CreateBucket([]byte(key))
+		if err != nil {
+			return err
+		}
+		if info.Parent != "" {
+			if err = sbkt.Put([]byte("parent"), []byte(info.Parent)); err != nil {
+				return err
+			}
+		}
+		if err = boltutil.WriteTimestamps(sbkt, info.Created, info.Updated); err != nil {
+			return err
+		}
+		if err = boltutil.WriteLabels(sbkt, info.Labels); err != nil {
+			return err
+		}
+		if err = sbkt.Put([]byte("name"), []byte(key)); err != nil {
+			return err
+		}
+
+		// Attach the snapshot to the mount lease named after it, if any
+		if lbkt := nestedBucket(nsbkt, "leases", key); lbkt != nil {
+			rbkt, err := lbkt.CreateBucketIfNotExists([]byte("snapshots"))
+			if err != nil {
+				return err
+			}
+			if rbkt, err = rbkt.CreateBucketIfNotExists([]byte(driver)); err != nil {
+				return err
+			}
+			if err = rbkt.Put([]byte(key), nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	for key := range keys {
+		parent := infos[key].Parent
+		if parent == "" {
+			continue
+		}
+		pbkt := bkt.Bucket([]byte(parent))
+		if pbkt == nil {
+			return fmt.Errorf("parent snapshot '%s' of '%s': %w", parent, key, errdefs.ErrNotFound)
+		}
+		cbkt, err := pbkt.CreateBucketIfNotExists([]byte("children"))
+		if err != nil {
+			return err
+		}
+		if err = cbkt.Put([]byte(key), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nestedBucket returns the bucket found following the given keys from bkt, nil if not found
+func nestedBucket(bkt *bolt.Bucket, keys ...string) *bolt.Bucket {
+	for _, k := range keys {
+		if bkt == nil {
+			return nil
+		}
+		bkt = bkt.Bucket([]byte(k))
+	}
+	return bkt
+}
@@ -0,0 +1,151 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd/v2/plugins/snapshots/native"
+	"github.com/containerd/errdefs"
+	bolt "go.etcd.io/bbolt"
+)
+
+// createDriverSnapshot commits a snapshot straight on the native driver of the store, as done
+// before snapshots were managed through the metadata database
+func createDriverSnapshot(t *testing.T, root, key string) {
+	t.Helper()
+	ctx := context.Background()
+	sn, err := native.NewSnapshotter(NewOCIStore(testLogger(t), root, WithDriver(NativeDriver)).snapshotterRoot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sn.Close()
+	if _, err = sn.Prepare(ctx, key+"-active", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = sn.Commit(ctx, key, key+"-active"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdoptLegacySnapshots(t *testing.T) {
+	root := t.TempDir()
+	createDriverSnapshot(t, root, "legacy")
+
+	cs := newTestStore(t, root)
+	sn := cs.cli.SnapshotService(NativeDriver)
+	if _, err := sn.Stat(cs.ctx, "legacy"); err != nil {
+		t.Fatalf("legacy snapshot not adopted: %v", err)
+	}
+	err := cs.bdb.View(func(tx *bolt.Tx) error {
+		if !legacySnapshotsAdopted(tx, NativeDriver) {
+			t.Error("adoption of legacy snapshots not recorded")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Adoption only runs once, later driver snapshots are not considered legacy
+	createDriverSnapshot(t, root, "late")
+	cs = newTestStore(t, root)
+	sn = cs.cli.SnapshotService(NativeDriver)
+	if _, err = sn.Stat(cs.ctx, "legacy"); err != nil {
+		t.Errorf("adopted snapshot lost: %v", err)
+	}
+	if _, err = sn.Stat(cs.ctx, "late"); !errdefs.IsNotFound(err) {
+		t.Errorf("expected snapshot created after the adoption to be ignored, got: %v", err)
+	}
+}
+
+func TestAdoptLegacySnapshotsEmptyStore(t *testing.T) {
+	root := t.TempDir()
+	cs := newTestStore(t, root)
+
+	// The adoption is also recorded for stores without snapshots
+	err := cs.bdb.View(func(tx *bolt.Tx) error {
+		if !legacySnapshotsAdopted(tx, NativeDriver) {
+			t.Error("adoption of legacy snapshots not recorded")
+		}
+		if legacySnapshotsAdopted(tx, OverlayDriver) {
+			t.Error("adoption recorded for a driver not in use")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoveNamespaceForce(t *testing.T) {
+	root := t.TempDir()
+	cs := newTestStore(t, root)
+	importTestImage(t, cs, "test/img:keep", testLayer{"file": "keep"})
+
+	if err := cs.CreateNamespace("other", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.SetNamespace("other"); err != nil {
+		t.Fatal(err)
+	}
+	importTestImage(t, cs, "test/img:other", testLayer{"file": "other"})
+	if err := cs.SetNamespace(DefaultNamespace); err != nil {
+		t.Fatal(err)
+	}
+
+	blobs := func() int {
+		t.Helper()
+		entries, err := os.ReadDir(filepath.Join(root, contentDir, "blobs", "sha256"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(entries)
+	}
+	before := blobs()
+
+	if err := cs.RemoveNamespace("other", false); err == nil {
+		t.Fatal("expected a namespace holding images not to be removed without force")
+	}
+	if err := cs.RemoveNamespace("other", true); err != nil {
+		t.Fatal(err)
+	}
+
+	nss, err := cs.ListNamespaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ns := range nss {
+		if ns == "other" {
+			t.Error("namespace 'other' not removed")
+		}
+	}
+
+	// The data of the namespace is released, the one of other namespaces kept
+	if after := blobs(); after >= before || after == 0 {
+		t.Errorf("expected blobs of the removed namespace to be released, %d blobs before and %d after", before, after)
+	}
+	if _, err = cs.Get("test/img:keep"); err != nil {
+		t.Errorf("image of the default namespace lost: %v", err)
+	}
+}
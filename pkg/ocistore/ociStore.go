@@ -21,19 +21,27 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/containerd/containerd/v2/client"
 	"github.com/containerd/containerd/v2/core/content"
 	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/containerd/v2/core/leases"
 	"github.com/containerd/containerd/v2/core/metadata"
 	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/containerd/v2/pkg/identifiers"
 	"github.com/containerd/containerd/v2/pkg/namespaces"
 	"github.com/containerd/containerd/v2/plugins/content/local"
+	"github.com/containerd/containerd/v2/plugins/snapshots/native"
 	"github.com/containerd/containerd/v2/plugins/snapshots/overlay"
+	"github.com/containerd/errdefs"
 	"github.com/containerd/platforms"
 	"github.com/davidcassany/ocistore/pkg/logger"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
@@ -41,13 +49,18 @@ import (
 )
 
 const (
-	overlayDriver = "overlayfs"
-	snapshotsDir  = "snapshots"
-	boltDbFile    = "metadata.db"
-	contentDir    = "content"
-	namespace     = "elemental-system"
+	snapshotsDir = "snapshots"
+	boltDbFile   = "metadata.db"
+	contentDir   = "content"
+	certsDir     = "certs.d"
+
+	OverlayDriver = "overlayfs"
+	NativeDriver  = "native"
+	BtrfsDriver   = "btrfs"
 
 	DefaultRoot         = "/tmp/contentstore"
+	DefaultNamespace    = "elemental-system"
+	DefaultDriver       = OverlayDriver
 	LabelSnapshotImgRef = "containerd.io/snapshot/image.ref"
 
 	missInitErrMsg = "uninitiated containerdstore instance"
@@ -57,69 +70,329 @@ type OCIStore struct {
 	log  logger.Logger
 	root string
 
-	// TODO create options to provide those
 	driver    string
 	namespace string
 	platform  platforms.MatchComparer
+	// platformSpec is the platform of images committed without a base image
+	platformSpec ocispec.Platform
+	cliOpts      []client.Opt
+
+	overlayOpts []overlay.Opt
+	mountLease  time.Duration
+	commitLease time.Duration
+	registry    RegistryConfig
+	credentials CredentialsFunc
+	gcPolicy    GCPolicy
+
+	config     *Config
+	configFile string
+	// configErr keeps the configuration loading failure, reported by Init
+	configErr error
+
+	lockTimeout time.Duration
+	shared      bool
+	readOnly    bool
+
+	ctx          context.Context
+	db           *metadata.DB
+	cli          *client.Client
+	bdb          *bolt.DB
+	content      content.Store
+	snapshotters map[string]snapshots.Snapshotter
+
+	// gcRec records the data removed by the metadata garbage collector, serialized by gcL
+	gcRec *gcRecorder
+	gcL   sync.Mutex
+
+	// opsL is held for reading by in-flight operations and for writing on Init and Close
+	opsL   sync.RWMutex
+	closed bool
+
+	lock    *storeLock
+	privDir string
+	// privLock is held by shared readers on their private folder, telling writers they are alive
+	privLock *storeLock
+	dirty    atomic.Bool
+}
+
+var (
+	// ErrClosed is returned by any operation called on an OCIStore instance after Close
+	ErrClosed = errors.New("containerdstore instance is closed")
+	// ErrReadOnly is returned by mutating operations on read-only or shared access stores
+	ErrReadOnly = errors.New("containerdstore instance is read-only")
+)
+
+type StoreOpt func(*OCIStore)
 
-	ctx context.Context
-	db  *metadata.DB
-	cli *client.Client
+// WithDriver sets the snapshotter driver used to unpack and mount images
+func WithDriver(driver string) StoreOpt {
+	return func(c *OCIStore) {
+		c.driver = driver
+	}
 }
 
-func NewOCIStore(log logger.Logger, root string) OCIStore {
-	return OCIStore{
-		root: root, driver: overlayDriver, namespace: namespace,
-		log: log, platform: platforms.DefaultStrict(),
+// WithNamespace sets the containerd namespace the store operates in
+func WithNamespace(namespace string) StoreOpt {
+	return func(c *OCIStore) {
+		c.namespace = namespace
 	}
 }
 
-func (c OCIStore) Logger() logger.Logger {
+// WithPlatform sets the default platform matcher used to select image manifests
+func WithPlatform(platform platforms.MatchComparer) StoreOpt {
+	return func(c *OCIStore) {
+		c.platform = platform
+	}
+}
+
+// WithDefaultPlatform sets the default platform of the store, images are selected strictly for it
+// and images committed without a base image are set to it. Defaults to the host platform.
+func WithDefaultPlatform(platform ocispec.Platform) StoreOpt {
+	return func(c *OCIStore) {
+		c.platformSpec = platforms.Normalize(platform)
+		c.platform = platforms.OnlyStrict(c.platformSpec)
+	}
+}
+
+// WithLockTimeout sets how long to wait for the store lock before failing with a StoreBusyError
+func WithLockTimeout(timeout time.Duration) StoreOpt {
+	return func(c *OCIStore) {
+		c.lockTimeout = timeout
+	}
+}
+
+// WithSharedAccess opens the store as a shared reader. Shared readers operate on a point in time
+// copy of the store metadata, so they can run next to a writer. Mutating operations are refused.
+func WithSharedAccess() StoreOpt {
+	return func(c *OCIStore) {
+		c.shared = true
+	}
+}
+
+// WithReadOnly opens the store without writing anything into its root, so it can be used from
+// read-only media. The metadata database is opened read-only and mutating operations are refused,
+// only read-only mounts are allowed and their views are not kept in the store.
+func WithReadOnly() StoreOpt {
+	return func(c *OCIStore) {
+		c.readOnly = true
+	}
+}
+
+// WithClientOpts appends additional options to the containerd client created on Init
+func WithClientOpts(opts ...client.Opt) StoreOpt {
+	return func(c *OCIStore) {
+		c.cliOpts = append(c.cliOpts, opts...)
+	}
+}
+
+// NewOCIStore creates a new store instance for the given root. The configuration file found in
+// root, if any, is applied first and then the given options. The instance is returned as a pointer
+// since it tracks in-flight operations and must not be copied.
+func NewOCIStore(log logger.Logger, root string, opts ...StoreOpt) *OCIStore {
+	c := defaultStore(log, root)
+	for _, o := range opts {
+		o(c)
+	}
+
+	// Options are evaluated first to find out the configuration to use, then the
+	// configuration is applied and options are evaluated again on top of it
+	cfg, err := c.loadConfig()
+	if err != nil {
+		c.configErr = err
+		return c
+	} else if cfg == nil {
+		return c
+	}
+
+	c = defaultStore(log, root)
+	c.config = cfg
+	c.configErr = cfg.apply(c)
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+func defaultStore(log logger.Logger, root string) *OCIStore {
+	return &OCIStore{
+		root: root, driver: DefaultDriver, namespace: DefaultNamespace,
+		log: log, platform: platforms.DefaultStrict(), platformSpec: platforms.DefaultSpec(),
+		lockTimeout: DefaultLockTimeout,
+		mountLease:  DefaultMountLease, commitLease: DefaultCommitLease,
+	}
+}
+
+// loadConfig returns the configuration set by options or the one from the config file. A missing
+// config file is only an error if it was explicitly requested.
+func (c *OCIStore) loadConfig() (*Config, error) {
+	if c.config != nil {
+		return c.config, nil
+	}
+	if c.configFile != "" {
+		return LoadConfig(c.configFile)
+	}
+	cfg, err := LoadConfig(filepath.Join(c.root, ConfigFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return cfg, err
+}
+
+func (c *OCIStore) Logger() logger.Logger {
 	return c.log
 }
 
-func (c *OCIStore) Init(mainCtx context.Context) error {
+// Config returns the configuration the store was created with, either set by WithConfig or loaded
+// from the configuration file. It is empty if there is no configuration file or it failed to load.
+func (c *OCIStore) Config() Config {
+	if c.config == nil || c.configErr != nil {
+		return Config{}
+	}
+	return *c.config
+}
+
+func (c *OCIStore) Init(mainCtx context.Context) (retErr error) {
+	c.opsL.Lock()
+	defer c.opsL.Unlock()
+
+	if c.IsInitiated() {
+		return errors.New("containerdstore instance already initiated")
+	}
+
+	if c.configErr != nil {
+		return c.configErr
+	}
+
 	var err error
 	snapshotters := map[string]snapshots.Snapshotter{}
 
-	ctx := namespaces.WithNamespace(mainCtx, "testing")
+	defer func() {
+		if retErr != nil {
+			c.closeBackends(snapshotters, nil)
+			c.releaseStore()
+		}
+	}()
+
+	if err = identifiers.Validate(c.namespace); err != nil {
+		return fmt.Errorf("invalid namespace '%s': %w", c.namespace, err)
+	}
+	ctx := namespaces.WithNamespace(mainCtx, c.namespace)
+
+	dbFile := filepath.Join(c.root, boltDbFile)
+	snRoot := c.snapshotterRoot()
+	if c.readOnly {
+		// The driver requires a writable metadata database, it runs on a private copy
+		c.privDir, err = os.MkdirTemp("", sharedRdrPfx)
+		if err != nil {
+			return err
+		}
+		snRoot = filepath.Join(c.privDir, filepath.Base(c.snapshotterRoot()))
+		if err = os.MkdirAll(snRoot, 0700); err != nil {
+			return err
+		}
+		if err = copyFile(filepath.Join(c.snapshotterRoot(), boltDbFile), filepath.Join(snRoot, boltDbFile)); err != nil {
+			return err
+		}
+		if err = linkSnapshotterData(c.snapshotterRoot(), snRoot); err != nil {
+			return err
+		}
+	} else if c.shared {
+		if err = os.MkdirAll(filepath.Join(c.root, sharedDir), 0755); err != nil {
+			return err
+		}
+		c.privDir, err = os.MkdirTemp(filepath.Join(c.root, sharedDir), sharedRdrPfx)
+		if err != nil {
+			return err
+		}
+		c.privLock, err = acquireLock(c.privDir, true, 0)
+		if err != nil {
+			return err
+		}
+		dbFile, snRoot, err = c.openSharedView(c.privDir)
+		if err != nil {
+			return err
+		}
+	} else {
+		c.lock, err = acquireLock(c.root, true, c.lockTimeout)
+		if err != nil {
+			return err
+		}
+		if err = sweepStaleReaders(c.root); err != nil {
+			c.log.Warnf("failed to remove the private copies of stale shared readers: %v", err)
+		}
+	}
 
 	switch c.driver {
-	case overlayDriver:
-		//TODO make overlay opts configurable
-		sn, err := overlay.NewSnapshotter(filepath.Join(c.root, snapshotsDir))
+	case OverlayDriver:
+		sn, err := overlay.NewSnapshotter(snRoot, c.overlayOpts...)
+		if err != nil {
+			return err
+		}
+		snapshotters[OverlayDriver] = sn
+	case NativeDriver:
+		sn, err := native.NewSnapshotter(snRoot)
+		if err != nil {
+			return err
+		}
+		snapshotters[NativeDriver] = sn
+	case BtrfsDriver:
+		sn, err := newBtrfsSnapshotter(snRoot)
 		if err != nil {
 			return err
 		}
-		snapshotters[overlayDriver] = sn
+		snapshotters[BtrfsDriver] = sn
 	default:
 		return fmt.Errorf("unsupported containerd driver '%s'", c.driver)
 	}
 
-	bdb, err := bolt.Open(filepath.Join(c.root, boltDbFile), 0644, nil)
-	if err != nil {
+	bdb, err := bolt.Open(dbFile, 0644, &bolt.Options{Timeout: c.lockTimeout, ReadOnly: c.readOnly})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return &StoreBusyError{PID: lockHolder(c.root)}
+	} else if err != nil {
 		return err
 	}
+	defer func() {
+		if retErr != nil {
+			c.closeBackends(nil, bdb)
+		}
+	}()
 
 	store, err := local.NewStore(filepath.Join(c.root, contentDir))
 	if err != nil {
 		return err
 	}
 
-	db := metadata.NewDB(bdb, store, snapshotters)
-	err = db.Init(ctx)
-	if err != nil {
-		return err
+	gcRec := &gcRecorder{}
+	db := metadata.NewDB(bdb, &gcContentStore{Store: store, rec: gcRec}, gcSnapshotters(snapshotters, gcRec))
+	if !c.readOnly {
+		err = db.Init(ctx)
+		if err != nil {
+			return err
+		}
+
+		// Shared readers adopt them on their private copy only, hence it is not worth to report
+		n, err := adoptLegacySnapshots(ctx, bdb, c.driver, snapshotters[c.driver])
+		if err != nil {
+			return fmt.Errorf("failed to adopt snapshots created before namespace isolation: %w", err)
+		} else if n > 0 && !c.shared {
+			c.log.Infof("Adopted %d snapshot(s) created before namespace isolation", n)
+		}
+
+		if err = removeGCSweepSnapshots(ctx, db); err != nil {
+			return fmt.Errorf("failed to clean up interrupted garbage collections: %w", err)
+		}
 	}
 
-	// TODO make client opts configurable
-	cli, err := client.NewWithConn(nil, client.WithServices(
-		client.WithContentStore(db.ContentStore()),
-		client.WithImageStore(metadata.NewImageStore(db)),
-		client.WithLeasesService(metadata.NewLeaseManager(db)),
-		client.WithDiffService(NewDiffService(db.ContentStore())),
-		client.WithSnapshotters(snapshotters),
-	), client.WithDefaultPlatform(c.platform))
+	cliOpts := []client.Opt{
+		client.WithServices(
+			client.WithContentStore(db.ContentStore()),
+			client.WithImageStore(metadata.NewImageStore(db)),
+			client.WithLeasesService(metadata.NewLeaseManager(db)),
+			client.WithDiffService(NewDiffService(db.ContentStore())),
+			client.WithSnapshotters(db.Snapshotters()),
+		), client.WithDefaultPlatform(c.platform),
+	}
+	cli, err := client.NewWithConn(nil, append(cliOpts, c.cliOpts...)...)
 	if err != nil {
 		return err
 	}
@@ -127,9 +400,153 @@ func (c *OCIStore) Init(mainCtx context.Context) error {
 	c.ctx = ctx
 	c.db = db
 	c.cli = cli
+	c.bdb = bdb
+	c.content = store
+	c.snapshotters = snapshotters
+	c.gcRec = gcRec
+	c.closed = false
+
+	if c.lock != nil {
+		db.RegisterMutationCallback(func(bool) {
+			c.dirty.Store(true)
+		})
+		if err = c.publishShared(); err != nil {
+			c.log.Warnf("failed to publish metadata for shared readers: %v", err)
+		}
+	}
 	return nil
 }
 
+// Close waits for any in-flight operation to finish and then closes the snapshotters and the
+// metadata database. Any later call on the instance returns ErrClosed until Init is called again.
+func (c *OCIStore) Close() error {
+	c.opsL.Lock()
+	defer c.opsL.Unlock()
+
+	if !c.IsInitiated() {
+		return nil
+	}
+
+	var errs []error
+	if err := c.cli.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed closing client: %w", err))
+	}
+	errs = append(errs, c.closeBackends(c.snapshotters, c.bdb)...)
+	if err := c.releaseStore(); err != nil {
+		errs = append(errs, err)
+	}
+
+	c.ctx = nil
+	c.db = nil
+	c.cli = nil
+	c.bdb = nil
+	c.content = nil
+	c.snapshotters = nil
+	c.gcRec = nil
+	c.closed = true
+
+	return errors.Join(errs...)
+}
+
+// closeBackends closes the given snapshotters and bolt database, in that order
+func (c *OCIStore) closeBackends(snapshotters map[string]snapshots.Snapshotter, bdb *bolt.DB) []error {
+	var errs []error
+	for name, sn := range snapshotters {
+		if err := sn.Close(); err != nil {
+			c.log.Debugf("failed closing snapshotter '%s': %v", name, err)
+			errs = append(errs, fmt.Errorf("failed closing snapshotter '%s': %w", name, err))
+		}
+	}
+	if bdb != nil {
+		if err := bdb.Close(); err != nil {
+			c.log.Debugf("failed closing metadata database: %v", err)
+			errs = append(errs, fmt.Errorf("failed closing metadata database: %w", err))
+		}
+	}
+	return errs
+}
+
+// releaseStore releases the store lock of writers or removes the private copy of shared readers
+func (c *OCIStore) releaseStore() error {
+	var err error
+	if c.lock != nil {
+		err = c.lock.release()
+		c.lock = nil
+	}
+	if c.privDir != "" {
+		err = errors.Join(err, os.RemoveAll(c.privDir))
+		c.privDir = ""
+	}
+	if c.privLock != nil {
+		err = errors.Join(err, c.privLock.release())
+		c.privLock = nil
+	}
+	return err
+}
+
+// startOp registers an in-flight operation. The returned function must be called once the
+// operation is done, Close waits for all registered operations before tearing down the store.
+func (c *OCIStore) startOp() (func(), error) {
+	c.opsL.RLock()
+	if c.closed {
+		c.opsL.RUnlock()
+		return nil, ErrClosed
+	}
+	if !c.IsInitiated() {
+		c.opsL.RUnlock()
+		return nil, errors.New(missInitErrMsg)
+	}
+	return func() {
+		c.opsL.RUnlock()
+		c.publishIfDirty()
+	}, nil
+}
+
+// startWriteOp registers an in-flight operation that mutates the store
+func (c *OCIStore) startWriteOp() (func(), error) {
+	if c.isReadOnly() {
+		return nil, ErrReadOnly
+	}
+	return c.startOp()
+}
+
+// isReadOnly returns true if changes can't be persisted in the store
+func (c *OCIStore) isReadOnly() bool {
+	return c.readOnly || c.shared
+}
+
+// withLease creates a lease for the operation. Leases are skipped on read-only stores
+// as the metadata database can't be written.
+func (c *OCIStore) withLease(ctx context.Context, opts ...leases.Opt) (context.Context, func(context.Context) error, error) {
+	if c.readOnly {
+		return ctx, func(context.Context) error { return nil }, nil
+	}
+	return c.cli.WithLease(ctx, opts...)
+}
+
+// driverSnapshotKey returns the key the driver uses for the given snapshot of the store namespace
+func (c *OCIStore) driverSnapshotKey(key string) (string, error) {
+	var name string
+	err := c.bdb.View(func(tx *bolt.Tx) error {
+		bkt := nestedBucket(tx.Bucket([]byte("v1")), c.namespace, "snapshots", c.driver, key)
+		if bkt == nil {
+			return fmt.Errorf("snapshot '%s': %w", key, errdefs.ErrNotFound)
+		}
+		name = string(bkt.Get([]byte("name")))
+		return nil
+	})
+	return name, err
+}
+
+// snapshotterRoot returns the root path of the configured driver. Overlay keeps the historic
+// snapshots folder, any other driver gets its own folder as on-disk layouts are not compatible
+func (c *OCIStore) snapshotterRoot() string {
+	if c.driver == OverlayDriver {
+		return filepath.Join(c.root, snapshotsDir)
+	}
+	return filepath.Join(c.root, snapshotsDir+"-"+c.driver)
+}
+
 func (c *OCIStore) IsInitiated() bool {
 	return c.ctx != nil
 }
@@ -148,6 +565,13 @@ func (c *OCIStore) GetDriver() string {
 	return c.driver
 }
 
+func (c *OCIStore) GetNamespace() string {
+	if !c.IsInitiated() {
+		return ""
+	}
+	return c.namespace
+}
+
 // Methods copied from nerdctl imgutils package, adding a dependency to nerdctl could be considered
 
 // ReadImageConfig reads the config spec (`application/vnd.oci.image.config.v1+json`) for img.platform from content store.
@@ -0,0 +1,186 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/mount"
+)
+
+func TestClose(t *testing.T) {
+	root := t.TempDir()
+	cs := newTestStore(t, root)
+	importTestImage(t, cs, "test/img:latest", testLayer{"file": "data"})
+
+	if err := cs.Close(); err != nil {
+		t.Fatalf("failed to close store: %v", err)
+	}
+	if err := cs.Close(); err != nil {
+		t.Errorf("closing twice failed: %v", err)
+	}
+	if cs.IsInitiated() {
+		t.Error("closed store still initiated")
+	}
+
+	for name, call := range map[string]func() error{
+		"list":     func() error { _, err := cs.List(); return err },
+		"get":      func() error { _, err := cs.Get("test/img:latest"); return err },
+		"inspect":  func() error { _, err := cs.Inspect("test/img:latest"); return err },
+		"delete":   func() error { return cs.Delete("test/img:latest") },
+		"pull":     func() error { _, err := cs.Pull("test/img:latest"); return err },
+		"import":   func() error { _, err := cs.ImportFile("missing.tar"); return err },
+		"gc":       func() error { _, err := cs.GarbageCollect(); return err },
+		"prune":    func() error { _, err := cs.Prune(); return err },
+		"leases":   func() error { _, err := cs.ListLeases(); return err },
+		"snapshot": func() error { _, err := cs.ListSnapshots(); return err },
+	} {
+		if err := call(); !errors.Is(err, ErrClosed) {
+			t.Errorf("%s: expected ErrClosed, got: %v", name, err)
+		}
+	}
+
+	// The lock is released, another instance opens the store right away
+	other := NewOCIStore(testLogger(t), root, WithDriver(NativeDriver), WithLockTimeout(100*time.Millisecond))
+	if err := other.Init(context.Background()); err != nil {
+		t.Fatalf("failed to open closed store: %v", err)
+	}
+	imgs, err := other.List()
+	if err != nil || len(imgs) != 1 {
+		t.Errorf("expected the image in the reopened store, got %d, %v", len(imgs), err)
+	}
+	if err = other.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Closed instances can be initiated again
+	if err = cs.Init(context.Background()); err != nil {
+		t.Fatalf("failed to init closed store again: %v", err)
+	}
+	if _, err = cs.Get("test/img:latest"); err != nil {
+		t.Errorf("failed to get image after init: %v", err)
+	}
+}
+
+// treeState returns the checksum and modification time of every file in root and the
+// destination of every symlink
+func treeState(t *testing.T, root string) map[string]string {
+	t.Helper()
+	state := map[string]string{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			dest, err := os.Readlink(path)
+			state[path] = "-> " + dest
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		state[path] = fmt.Sprintf("%x %s", sha256.Sum256(data), info.ModTime())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestReadOnly(t *testing.T) {
+	root := t.TempDir()
+	cs := newTestStore(t, root)
+	importTestImage(t, cs, "test/img:latest", testLayer{"file": "data"})
+	img, err := cs.Get("test/img:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cs.Unpack(img); err != nil {
+		t.Fatal(err)
+	}
+	snaps, err := cs.ListSnapshots()
+	if err != nil || len(snaps) == 0 {
+		t.Fatalf("expected unpacked snapshots, got %d, %v", len(snaps), err)
+	}
+	if err = cs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	before := treeState(t, root)
+
+	ro := newTestStore(t, root, WithReadOnly())
+	imgs, err := ro.List()
+	if err != nil || len(imgs) != 1 {
+		t.Errorf("expected to list the image, got %d, %v", len(imgs), err)
+	}
+	if _, err = ro.Inspect("test/img:latest"); err != nil {
+		t.Errorf("failed to inspect image: %v", err)
+	}
+	if os.Geteuid() == 0 {
+		img, err = ro.Get("test/img:latest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		target := t.TempDir()
+		key, err := ro.Mount(img, target, "", true)
+		if err != nil {
+			t.Errorf("failed to view image: %v", err)
+		} else {
+			t.Cleanup(func() { _ = mount.UnmountAll(target, 0) })
+			if data, err := os.ReadFile(filepath.Join(target, "file")); err != nil || string(data) != "data" {
+				t.Errorf("unexpected view content '%s': %v", data, err)
+			}
+			if err = ro.Umount(target, key, 0); err != nil {
+				t.Errorf("failed to unmount view: %v", err)
+			}
+		}
+	}
+
+	for name, call := range map[string]func() error{
+		"pull":     func() error { _, err := ro.Pull("test/img:latest"); return err },
+		"delete":   func() error { return ro.Delete("test/img:latest") },
+		"snapshot": func() error { _, err := ro.UpdateSnapshot(snaps[0], "labels.test"); return err },
+		"import":   func() error { _, err := ro.ImportFile("missing.tar"); return err },
+		"tag":      func() error { _, err := ro.Tag("test/img:latest", "test/img:other", false); return err },
+		"mount":    func() error { _, err := ro.Mount(img, t.TempDir(), "", false); return err },
+	} {
+		if err := call(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s: expected ErrReadOnly, got: %v", name, err)
+		}
+	}
+	if err = ro.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if after := treeState(t, root); !maps.Equal(before, after) {
+		t.Errorf("read-only store modified its root:\nbefore: %v\nafter:  %v", before, after)
+	}
+}
@@ -0,0 +1,203 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/containerd/v2/core/remotes"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const progressInterval = 100 * time.Millisecond
+
+type ProgressStatus string
+
+const (
+	// ProgressResolving is reported for the image reference while it is resolved in the registry
+	ProgressResolving ProgressStatus = "resolving"
+	// ProgressWaiting is reported for descriptors queued for download
+	ProgressWaiting ProgressStatus = "waiting"
+	// ProgressDownloading is reported for descriptors being downloaded
+	ProgressDownloading ProgressStatus = "downloading"
+	// ProgressVerifying is reported for fully downloaded descriptors not yet committed
+	ProgressVerifying ProgressStatus = "verifying"
+	// ProgressExists is reported for descriptors already in the store before the pull
+	ProgressExists ProgressStatus = "exists"
+	// ProgressDone is reported for descriptors downloaded and committed to the store and for the
+	// image reference once resolved
+	ProgressDone ProgressStatus = "done"
+)
+
+// ProgressEvent reports the state of a pull, either of the image reference being resolved or of
+// a descriptor being fetched. Offset and Total are the bytes done and expected.
+type ProgressEvent struct {
+	// Ref is the image reference on the events of its resolution, otherwise the ingest reference of the
+	// descriptor, e.g. layer-sha256:<hex>
+	Ref       string
+	Status    ProgressStatus
+	MediaType string        `json:",omitempty"`
+	Digest    digest.Digest `json:",omitempty"`
+	Offset    int64
+	Total     int64
+	Time      time.Time
+}
+
+// pullProgress tracks the descriptors fetched by a pull and polls the ingests of the content
+// store to report their progress. Events are emitted sequentially from a single goroutine.
+type pullProgress struct {
+	ctx      context.Context
+	cs       content.Store
+	ref      string
+	resolved bool
+	fn       func(ProgressEvent)
+	stop     chan struct{}
+	done     chan struct{}
+
+	mu     sync.Mutex
+	jobs   []ocispec.Descriptor
+	refs   map[string]bool
+	exists map[string]bool
+	last   map[string]ProgressEvent
+}
+
+// startPullProgress reports the resolution of ref and starts polling the progress of the
+// descriptors tracked by the returned handler
+func startPullProgress(ctx context.Context, cs content.Store, ref string, fn func(ProgressEvent)) *pullProgress {
+	p := &pullProgress{
+		ctx:    ctx,
+		cs:     cs,
+		ref:    ref,
+		fn:     fn,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		refs:   map[string]bool{},
+		exists: map[string]bool{},
+		last:   map[string]ProgressEvent{},
+	}
+	fn(ProgressEvent{Ref: ref, Status: ProgressResolving, Time: time.Now()})
+
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.poll()
+			case <-p.stop:
+				p.poll()
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// handler records every descriptor dispatched by the fetch, it must run before the content
+// is fetched to tell apart the content already in the store
+func (p *pullProgress) handler() images.Handler {
+	return images.HandlerFunc(func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		ref := remotes.MakeRefKey(ctx, desc)
+		_, err := p.cs.Info(ctx, desc.Digest)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if !p.refs[ref] {
+			p.refs[ref] = true
+			p.exists[ref] = err == nil
+			p.jobs = append(p.jobs, desc)
+		}
+		return nil, nil
+	})
+}
+
+// finish stops polling once the last state of all descriptors has been reported
+func (p *pullProgress) finish() {
+	close(p.stop)
+	<-p.done
+}
+
+func (p *pullProgress) poll() {
+	active := map[string]content.Status{}
+	statuses, err := p.cs.ListStatuses(p.ctx)
+	if err == nil {
+		for _, st := range statuses {
+			active[st.Ref] = st
+		}
+	}
+
+	p.mu.Lock()
+	jobs := make([]ocispec.Descriptor, len(p.jobs))
+	copy(jobs, p.jobs)
+	p.mu.Unlock()
+
+	// The fetch dispatches descriptors once the reference is resolved
+	if !p.resolved && len(jobs) > 0 {
+		p.resolved = true
+		p.fn(ProgressEvent{Ref: p.ref, Status: ProgressDone, Time: time.Now()})
+	}
+
+	for _, desc := range jobs {
+		ref := remotes.MakeRefKey(p.ctx, desc)
+		last, ok := p.last[ref]
+		if ok && (last.Status == ProgressDone || last.Status == ProgressExists) {
+			continue
+		}
+
+		ev := ProgressEvent{
+			Ref:       ref,
+			MediaType: desc.MediaType,
+			Digest:    desc.Digest,
+			Total:     desc.Size,
+		}
+		p.mu.Lock()
+		exists := p.exists[ref]
+		p.mu.Unlock()
+
+		if st, ok := active[ref]; ok {
+			ev.Status = ProgressDownloading
+			ev.Offset = st.Offset
+			if st.Total > 0 {
+				ev.Total = st.Total
+			}
+			if ev.Total > 0 && ev.Offset >= ev.Total {
+				ev.Status = ProgressVerifying
+			}
+		} else if exists {
+			ev.Status = ProgressExists
+			ev.Offset = ev.Total
+		} else if _, err := p.cs.Info(p.ctx, desc.Digest); err == nil {
+			ev.Status = ProgressDone
+			ev.Offset = ev.Total
+		} else {
+			ev.Status = ProgressWaiting
+		}
+
+		if ok && last.Status == ev.Status && last.Offset == ev.Offset {
+			continue
+		}
+		ev.Time = time.Now()
+		p.last[ref] = ev
+		p.fn(ev)
+	}
+}
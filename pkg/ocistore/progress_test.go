@@ -0,0 +1,108 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"crypto/rand"
+	"sync"
+	"testing"
+)
+
+// testLargeLayer returns a layer of the given size that does not compress. Downloads are written
+// to the store in chunks of 1MiB, larger layers report partial progress.
+func testLargeLayer(t *testing.T, size int) testLayer {
+	t.Helper()
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return testLayer{"large": string(data)}
+}
+
+func TestPullProgress(t *testing.T) {
+	reg := newTestRegistry(t, false)
+	remote := pushTestImage(t, reg, "test/progress:latest", testLayer{"file": "data"}, testLargeLayer(t, 3<<20))
+	large := reg.largestBlob()
+	reg.intercept = reg.slowBlob(large, 3*progressInterval)
+
+	cs := newTestStore(t, t.TempDir(), WithRegistryConfig(RegistryConfig{PlainHTTP: []string{reg.host()}}))
+	pull := func() []ProgressEvent {
+		t.Helper()
+		var mu sync.Mutex
+		var events []ProgressEvent
+		_, err := cs.Pull(remote, WithPullProgress(func(ev ProgressEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, ev)
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return events
+	}
+
+	events := pull()
+	if len(events) < 2 || events[0].Ref != remote || events[0].Status != ProgressResolving ||
+		events[1].Ref != remote || events[1].Status != ProgressDone {
+		t.Fatalf("expected the reference to be resolved first, got %v", events)
+	}
+
+	// Every descriptor moves forward through the states and ends up done
+	order := map[ProgressStatus]int{ProgressWaiting: 0, ProgressDownloading: 1, ProgressVerifying: 2, ProgressDone: 3}
+	last := map[string]ProgressEvent{}
+	var partial bool
+	for _, ev := range events[2:] {
+		if ev.Ref == remote || ev.Digest == "" {
+			t.Errorf("unexpected event after the reference was resolved: %v", ev)
+			continue
+		}
+		if ev.Time.IsZero() {
+			t.Errorf("event without time: %v", ev)
+		}
+		if prev, ok := last[ev.Ref]; ok && (order[ev.Status] < order[prev.Status] || ev.Offset < prev.Offset) {
+			t.Errorf("descriptor '%s' went back from %v to %v", ev.Ref, prev, ev)
+		}
+		if ev.Digest == large && ev.Status == ProgressDownloading && ev.Offset > 0 && ev.Offset < ev.Total {
+			partial = true
+		}
+		last[ev.Ref] = ev
+	}
+	// Index or manifest, config and two layers
+	if len(last) != 4 {
+		t.Errorf("expected events of 4 descriptors, got %d", len(last))
+	}
+	for ref, ev := range last {
+		if ev.Status != ProgressDone || ev.Offset != ev.Total {
+			t.Errorf("descriptor '%s' did not finish: %v", ref, ev)
+		}
+	}
+	if !partial {
+		t.Error("no progress reported while downloading the large layer")
+	}
+
+	// Pulling again finds everything in the store
+	reg.intercept = nil
+	events = pull()
+	for _, ev := range events[2:] {
+		if ev.Status != ProgressExists {
+			t.Errorf("expected descriptor '%s' to exist, got %s", ev.Ref, ev.Status)
+		}
+	}
+	if len(events) != 6 {
+		t.Errorf("expected one event per descriptor, got %v", events)
+	}
+}
@@ -0,0 +1,446 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/containerd/v2/core/leases"
+	"github.com/containerd/containerd/v2/core/metadata"
+	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/containerd/v2/pkg/reference"
+	"github.com/containerd/errdefs"
+	"github.com/moby/sys/mountinfo"
+)
+
+// LabelImageProtected protects the image from being pruned, whatever its value
+const LabelImageProtected = "containerd.io/image/prune.protect"
+
+// PruneReport describes the images and snapshots removed by Prune and the data released by the
+// subsequent garbage collection, or what would be removed in case of a dry run
+type PruneReport struct {
+	DryRun    bool
+	Images    []images.Image
+	Snapshots []snapshots.Info
+	GC        *GCReport
+}
+
+type PruneOpts struct {
+	dryRun    bool
+	all       bool
+	filters   []string
+	keep      int
+	olderThan time.Duration
+}
+
+type PruneOpt func(*PruneOpts) error
+
+// WithPruneDryRun reports what would be pruned without removing anything
+func WithPruneDryRun() PruneOpt {
+	return func(pOpts *PruneOpts) error {
+		pOpts.dryRun = true
+		return nil
+	}
+}
+
+// WithPruneAll prunes tagged images too, by default only dangling images, named after their
+// digest only, are pruned
+func WithPruneAll() PruneOpt {
+	return func(pOpts *PruneOpts) error {
+		pOpts.all = true
+		return nil
+	}
+}
+
+// WithPruneFilters only prunes images matching any of the given containerd filters
+func WithPruneFilters(filters ...string) PruneOpt {
+	return func(pOpts *PruneOpts) error {
+		pOpts.filters = append(pOpts.filters, filters...)
+		return nil
+	}
+}
+
+// WithPruneKeep keeps the given number of newest images out of the ones that would be pruned
+func WithPruneKeep(n int) PruneOpt {
+	return func(pOpts *PruneOpts) error {
+		if n < 0 {
+			return fmt.Errorf("invalid number of images to keep '%d': %w", n, errdefs.ErrInvalidArgument)
+		}
+		pOpts.keep = n
+		return nil
+	}
+}
+
+// WithPruneOlderThan only prunes images created longer than the given duration ago
+func WithPruneOlderThan(d time.Duration) PruneOpt {
+	return func(pOpts *PruneOpts) error {
+		if d <= 0 {
+			return fmt.Errorf("invalid image age '%s': %w", d, errdefs.ErrInvalidArgument)
+		}
+		pOpts.olderThan = d
+		return nil
+	}
+}
+
+// Prune removes the images selected by the given options together with the snapshots no longer
+// needed and runs the garbage collector to release unreferenced content. Pruned snapshots are the
+// committed snapshots no image or kept snapshot references and the active snapshots and views not
+// recorded as mounted, not leased and not mounted in the system. Images labelled with
+// LabelImageProtected and images in use by any kept snapshot are never pruned. Snapshots only kept
+// because they are mounted in the system get a mount lease, so the garbage collector keeps them too.
+func (c *OCIStore) Prune(opts ...PruneOpt) (*PruneReport, error) {
+	pOpt := &PruneOpts{}
+	for _, o := range opts {
+		err := o(pOpt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// A dry run operates on a copy of the metadata, hence it is not a mutating operation
+	startOp := c.startWriteOp
+	if pOpt.dryRun {
+		startOp = c.startOp
+	}
+	release, err := startOp()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	report, err := c.prune(c.ctx, pOpt)
+	if err != nil {
+		c.log.Errorf("failed to prune store: %v", err)
+		return nil, err
+	}
+	if !report.DryRun {
+		c.log.Infof("Successfully pruned %d image(s) and %d snapshot(s)", len(report.Images), len(report.Snapshots))
+	}
+	return report, nil
+}
+
+func (c *OCIStore) prune(ctx context.Context, pOpt *PruneOpts) (*PruneReport, error) {
+	c.gcL.Lock()
+	defer c.gcL.Unlock()
+
+	db, bdb, rec := c.db, c.bdb, c.gcRec
+	is, sn, lm := c.cli.ImageService(), c.cli.SnapshotService(c.driver), c.cli.LeasesService()
+	if pOpt.dryRun {
+		var cleanup func()
+		var err error
+		db, bdb, rec, cleanup, err = c.dryRunDB(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		is, sn, lm = metadata.NewImageStore(db), db.Snapshotter(c.driver), metadata.NewLeaseManager(db)
+	}
+
+	report := &PruneReport{DryRun: pOpt.dryRun}
+	if err := c.pruneImagesAndSnapshots(ctx, is, sn, lm, pOpt, report); err != nil {
+		return nil, err
+	}
+
+	gcReport, err := c.collect(ctx, db, bdb, rec, pOpt.dryRun)
+	if err != nil {
+		return nil, err
+	}
+	report.GC = gcReport
+	return report, nil
+}
+
+func (c *OCIStore) pruneImagesAndSnapshots(ctx context.Context, is images.Store, sn snapshots.Snapshotter, lm leases.Manager, pOpt *PruneOpts, report *PruneReport) error {
+	infos, err := listSnapshots(ctx, sn)
+	if err != nil && !errdefs.IsNotFound(err) {
+		return err
+	}
+	snaps := map[string]snapshots.Info{}
+	for _, info := range infos {
+		snaps[info.Name] = info
+	}
+
+	ls, err := c.listLeases(ctx)
+	if err != nil {
+		return err
+	}
+	leased := map[string]bool{}
+	for _, l := range ls {
+		if l.Expired() {
+			continue
+		}
+		if key, ok := l.Labels["containerd.io/gc.ref.snapshot."+c.driver]; ok {
+			leased[key] = true
+		}
+		for _, r := range l.Resources {
+			if r.Type == "snapshots/"+c.driver {
+				leased[r.ID] = true
+			}
+		}
+	}
+
+	records, err := c.listMountRecords()
+	if err != nil {
+		return err
+	}
+	recorded := map[string]bool{}
+	inUse := map[string]bool{}
+	for _, r := range records {
+		recorded[r.Key] = true
+		if r.Image != "" {
+			inUse[r.Image] = true
+		}
+	}
+
+	sysMounts, err := mountinfo.GetMounts(nil)
+	if err != nil {
+		return fmt.Errorf("failed to read system mounts: %w", err)
+	}
+
+	// Active snapshots and views are kept if anything still uses them
+	var kept, pruned []snapshots.Info
+	keptParents := map[string]bool{}
+	for _, info := range infos {
+		if info.Kind == snapshots.KindCommitted {
+			continue
+		}
+		_, root := info.Labels["containerd.io/gc.root"]
+		used := recorded[info.Name] || leased[info.Name] || root
+		if !used {
+			sMounts, err := sn.Mounts(ctx, info.Name)
+			if err != nil {
+				return err
+			}
+			used = snapshotMounted(sMounts, sysMounts)
+			if used {
+				// Nothing but the system mount references the snapshot, lease it as
+				// Mount does so the garbage collector keeps it too
+				if err = leaseMountedSnapshot(ctx, lm, c.driver, info.Name, c.mountLease); err != nil {
+					return err
+				}
+			}
+		}
+		if !used {
+			pruned = append(pruned, info)
+			continue
+		}
+		kept = append(kept, info)
+		keptParents[info.Parent] = true
+		if ref := info.Labels[LabelSnapshotImgRef]; ref != "" {
+			inUse[ref] = true
+		}
+	}
+
+	imgs, err := is.List(ctx)
+	if err != nil {
+		return err
+	}
+	imgSnaps := map[string]map[string]bool{}
+	for _, img := range imgs {
+		_, iSnaps, err := c.imageResources(ctx, sn, img)
+		if err != nil {
+			return err
+		}
+		imgSnaps[img.Name] = iSnaps
+
+		// Images are in use if a kept snapshot is based on their top snapshot
+		parents := map[string]bool{}
+		for key := range iSnaps {
+			parents[snaps[key].Parent] = true
+		}
+		for key := range iSnaps {
+			if !parents[key] && keptParents[key] {
+				inUse[img.Name] = true
+				break
+			}
+		}
+	}
+
+	candidates, err := c.pruneCandidates(ctx, is, imgs, pOpt)
+	if err != nil {
+		return err
+	}
+	for _, img := range candidates {
+		if _, ok := img.Labels[LabelImageProtected]; ok {
+			c.log.Debugf("keeping protected image '%s'", img.Name)
+			continue
+		}
+		if inUse[img.Name] {
+			c.log.Debugf("keeping image '%s' in use", img.Name)
+			continue
+		}
+		if err = is.Delete(ctx, img.Name); err != nil {
+			return fmt.Errorf("failed to prune image '%s': %w", img.Name, err)
+		}
+		delete(imgSnaps, img.Name)
+		report.Images = append(report.Images, img)
+	}
+
+	for _, info := range pruned {
+		if err = sn.Remove(ctx, info.Name); err != nil {
+			return fmt.Errorf("failed to prune snapshot '%s': %w", info.Name, err)
+		}
+		report.Snapshots = append(report.Snapshots, info)
+	}
+
+	// Committed snapshots are kept if referenced by a remaining image, by a kept snapshot
+	// or if they are leased or garbage collection roots themselves
+	referenced := map[string]bool{}
+	markReferenced := func(key string) {
+		for key != "" && !referenced[key] {
+			referenced[key] = true
+			key = snaps[key].Parent
+		}
+	}
+	for _, iSnaps := range imgSnaps {
+		for key := range iSnaps {
+			markReferenced(key)
+		}
+	}
+	for _, info := range kept {
+		markReferenced(info.Parent)
+	}
+	for _, info := range infos {
+		if info.Kind != snapshots.KindCommitted {
+			continue
+		}
+		if _, root := info.Labels["containerd.io/gc.root"]; root || leased[info.Name] {
+			markReferenced(info.Name)
+		}
+	}
+	var unreferenced []snapshots.Info
+	for _, info := range infos {
+		if info.Kind == snapshots.KindCommitted && !referenced[info.Name] {
+			unreferenced = append(unreferenced, info)
+		}
+	}
+
+	// Children have to be removed before their parents
+	depth := func(key string) int {
+		var d int
+		for ; key != ""; key = snaps[key].Parent {
+			d++
+		}
+		return d
+	}
+	sort.SliceStable(unreferenced, func(i, j int) bool {
+		return depth(unreferenced[i].Name) > depth(unreferenced[j].Name)
+	})
+	for _, info := range unreferenced {
+		if err = sn.Remove(ctx, info.Name); err != nil {
+			return fmt.Errorf("failed to prune snapshot '%s': %w", info.Name, err)
+		}
+		report.Snapshots = append(report.Snapshots, info)
+	}
+	return nil
+}
+
+// leaseMountedSnapshot creates the mount lease of the given snapshot
+func leaseMountedSnapshot(ctx context.Context, lm leases.Manager, driver, key string, exp time.Duration) error {
+	l, err := lm.Create(ctx,
+		leases.WithID(key),
+		leases.WithExpiration(exp),
+		leases.WithLabel("containerd.io/gc.ref.snapshot."+driver, key),
+	)
+	if errdefs.IsAlreadyExists(err) {
+		l = leases.Lease{ID: key}
+	} else if err != nil {
+		return fmt.Errorf("failed to lease mounted snapshot '%s': %w", key, err)
+	}
+	err = lm.AddResource(ctx, l, leases.Resource{ID: key, Type: "snapshots/" + driver})
+	if err != nil {
+		return fmt.Errorf("failed to lease mounted snapshot '%s': %w", key, err)
+	}
+	return nil
+}
+
+// pruneCandidates returns the images to prune according to the given options, newest first,
+// regardless of whether they are protected or in use
+func (c *OCIStore) pruneCandidates(ctx context.Context, is images.Store, imgs []images.Image, pOpt *PruneOpts) ([]images.Image, error) {
+	if len(pOpt.filters) > 0 {
+		var err error
+		imgs, err = is.List(ctx, pOpt.filters...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var candidates []images.Image
+	for _, img := range imgs {
+		if pOpt.all || isDanglingImage(img.Name) {
+			candidates = append(candidates, img)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].CreatedAt.After(candidates[j].CreatedAt)
+	})
+
+	if pOpt.keep >= len(candidates) {
+		return nil, nil
+	}
+	candidates = candidates[pOpt.keep:]
+
+	if pOpt.olderThan > 0 {
+		deadline := time.Now().Add(-pOpt.olderThan)
+		for i, img := range candidates {
+			if img.CreatedAt.Before(deadline) {
+				return candidates[i:], nil
+			}
+		}
+		return nil, nil
+	}
+	return candidates, nil
+}
+
+// isDanglingImage checks whether the image is only named after its digest, without any tag
+func isDanglingImage(name string) bool {
+	spec, err := reference.Parse(name)
+	return err == nil && strings.HasPrefix(spec.Object, "@")
+}
+
+// ProtectImage sets or removes the LabelImageProtected label of the given image
+func (c *OCIStore) ProtectImage(ref string, protect bool) error {
+	release, err := c.startWriteOp()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	is := c.cli.ImageService()
+	img, err := is.Get(c.ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	if img.Labels == nil {
+		img.Labels = map[string]string{}
+	}
+	if protect {
+		img.Labels[LabelImageProtected] = "true"
+	} else {
+		delete(img.Labels, LabelImageProtected)
+	}
+	if _, err = is.Update(c.ctx, img, "labels."+LabelImageProtected); err != nil {
+		c.log.Errorf("failed to update image '%s': %v", ref, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/containerd/v2/core/leases"
+	"github.com/containerd/containerd/v2/core/mount"
+	"github.com/containerd/errdefs"
+)
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestIsDanglingImage(t *testing.T) {
+	for name, dangling := range map[string]bool{
+		"docker.io/library/alpine@" + testDigest:      true,
+		"registry.local:5000/img@" + testDigest:       true,
+		"docker.io/library/alpine:3.20":               false,
+		"docker.io/library/alpine:3.20@" + testDigest: false,
+		"registry.local:5000/img:latest":              false,
+		"not a reference":                             false,
+		"":                                            false,
+	} {
+		if got := isDanglingImage(name); got != dangling {
+			t.Errorf("expected isDanglingImage('%s') to be %v, got %v", name, dangling, got)
+		}
+	}
+}
+
+func TestPruneCandidates(t *testing.T) {
+	now := time.Now()
+	img := func(name string, age time.Duration) images.Image {
+		return images.Image{Name: name, CreatedAt: now.Add(-age)}
+	}
+	imgs := []images.Image{
+		img("test/a@"+testDigest, 3*time.Hour),
+		img("test/b:latest", 2*time.Hour),
+		img("test/c@"+testDigest, time.Hour),
+		img("test/d:latest", 4*time.Hour),
+	}
+	names := func(imgs []images.Image) []string {
+		var n []string
+		for _, i := range imgs {
+			n = append(n, i.Name)
+		}
+		return n
+	}
+
+	c := &OCIStore{}
+	for name, tc := range map[string]struct {
+		opts []PruneOpt
+		want []string
+	}{
+		"dangling": {nil, []string{"test/c@" + testDigest, "test/a@" + testDigest}},
+		"all":      {[]PruneOpt{WithPruneAll()}, []string{"test/c@" + testDigest, "test/b:latest", "test/a@" + testDigest, "test/d:latest"}},
+		"keep":     {[]PruneOpt{WithPruneAll(), WithPruneKeep(2)}, []string{"test/a@" + testDigest, "test/d:latest"}},
+		"keep all": {[]PruneOpt{WithPruneKeep(2)}, nil},
+		"older":    {[]PruneOpt{WithPruneAll(), WithPruneOlderThan(150 * time.Minute)}, []string{"test/a@" + testDigest, "test/d:latest"}},
+		"none old": {[]PruneOpt{WithPruneOlderThan(5 * time.Hour)}, nil},
+		"keep and older": {
+			[]PruneOpt{WithPruneAll(), WithPruneKeep(3), WithPruneOlderThan(90 * time.Minute)}, []string{"test/d:latest"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			pOpt := &PruneOpts{}
+			for _, o := range tc.opts {
+				if err := o(pOpt); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := c.pruneCandidates(context.Background(), nil, imgs, pOpt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g := names(got); len(g) != len(tc.want) || (len(g) > 0 && !containsAll(g, tc.want...)) {
+				t.Errorf("expected candidates %v, got %v", tc.want, g)
+			} else {
+				for i := range g {
+					if g[i] != tc.want[i] {
+						t.Errorf("expected candidates %v newest first, got %v", tc.want, g)
+						break
+					}
+				}
+			}
+		})
+	}
+
+	if err := WithPruneKeep(-1)(&PruneOpts{}); !errdefs.IsInvalidArgument(err) {
+		t.Errorf("expected an invalid argument error, got: %v", err)
+	}
+}
+
+func TestPruneKeepsMountedSnapshots(t *testing.T) {
+	requireRoot(t)
+	cs := newTestStore(t, t.TempDir(), WithDriver(OverlayDriver))
+
+	// Views mounted by other means, neither recorded nor leased. Leases are deleted without
+	// running the garbage collector, as if they had expired.
+	mountView := func(name string) (string, string) {
+		t.Helper()
+		ref := "test/" + name + ":latest"
+		importTestImage(t, cs, ref, testLayer{"name": name}, testLayer{"data": "data"})
+		target, key := mountTestImage(t, cs, ref, true)
+		if err := cs.removeMount(target); err != nil {
+			t.Fatal(err)
+		}
+		if err := cs.cli.LeasesService().Delete(cs.ctx, leases.Lease{ID: key}); err != nil {
+			t.Fatal(err)
+		}
+		return target, key
+	}
+	_, mounted := mountView("mounted")
+	target, abandoned := mountView("abandoned")
+	if err := mount.UnmountAll(target, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := cs.Prune(WithPruneAll())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pruned []string
+	for _, s := range report.Snapshots {
+		pruned = append(pruned, s.Name)
+	}
+	if !containsAll(pruned, abandoned) || containsAll(pruned, mounted) {
+		t.Errorf("expected '%s' to be pruned and '%s' kept, pruned %v", abandoned, mounted, pruned)
+	}
+	var prunedImgs []string
+	for _, img := range report.Images {
+		prunedImgs = append(prunedImgs, img.Name)
+	}
+	if len(prunedImgs) != 1 || prunedImgs[0] != "test/abandoned:latest" {
+		t.Errorf("expected only the image of the abandoned view to be pruned, got %v", prunedImgs)
+	}
+	if _, err = cs.cli.SnapshotService(cs.driver).Stat(cs.ctx, mounted); err != nil {
+		t.Errorf("mounted snapshot lost: %v", err)
+	}
+}
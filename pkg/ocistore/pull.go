@@ -17,16 +17,25 @@ limitations under the License.
 package ocistore
 
 import (
-	"errors"
+	"fmt"
+	"path/filepath"
 	"reflect"
 
 	"github.com/containerd/containerd/v2/client"
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/containerd/v2/core/remotes/docker"
+	"github.com/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 type PullOpts struct {
-	aOpts  []ApplyCommitOpt
-	rOpts  []client.RemoteOpt
-	unpack bool
+	aOpts     []ApplyCommitOpt
+	rOpts     []client.RemoteOpt
+	platforms []ocispec.Platform
+	creds     *Credentials
+	progress  func(ProgressEvent)
+	retry     RetryPolicy
+	unpack    bool
 }
 
 type PullOpt func(*PullOpts) error
@@ -45,6 +54,53 @@ func WithPullUnpack() PullOpt {
 	}
 }
 
+// WithPullPlatforms sets the platforms to fetch the image content for, defaults to the store
+// platform. The image is unpacked for the first one.
+func WithPullPlatforms(platforms ...ocispec.Platform) PullOpt {
+	return func(pOpts *PullOpts) error {
+		pOpts.platforms = append(pOpts.platforms, platforms...)
+		return nil
+	}
+}
+
+// WithPullCredentials authenticates against the registry of the pulled image with the given
+// credentials instead of the store ones
+func WithPullCredentials(creds Credentials) PullOpt {
+	return func(pOpts *PullOpts) error {
+		pOpts.creds = &creds
+		return nil
+	}
+}
+
+// WithPullProgress calls fn with the progress of the image resolution and of every descriptor
+// fetched. Events are emitted sequentially, only when the state of a descriptor changes, and fn
+// is expected to return quickly.
+func WithPullProgress(fn func(ProgressEvent)) PullOpt {
+	return func(pOpts *PullOpts) error {
+		pOpts.progress = fn
+		return nil
+	}
+}
+
+// WithPullMaxConcurrentDownloads limits the number of blobs downloaded at once, 0 is unlimited.
+// Without this option the containerd client default applies, which sets no limit. The ocistore
+// CLI sets a limit of 3 unless told otherwise by its --max-concurrent-downloads flag.
+func WithPullMaxConcurrentDownloads(max int) PullOpt {
+	return func(pOpts *PullOpts) error {
+		pOpts.rOpts = append(pOpts.rOpts, client.WithMaxConcurrentDownloads(max))
+		return nil
+	}
+}
+
+// WithPullRetry retries the pull on transient registry errors according to the given policy,
+// by default it is not retried. Blobs partially downloaded are resumed on every attempt.
+func WithPullRetry(policy RetryPolicy) PullOpt {
+	return func(pOpts *PullOpts) error {
+		pOpts.retry = policy
+		return nil
+	}
+}
+
 func WithPullApplyCommitOpts(opts ...ApplyCommitOpt) PullOpt {
 	return func(pOpts *PullOpts) error {
 		pOpts.aOpts = append(pOpts.aOpts, opts...)
@@ -53,9 +109,11 @@ func WithPullApplyCommitOpts(opts ...ApplyCommitOpt) PullOpt {
 }
 
 func (c *OCIStore) Pull(ref string, opts ...PullOpt) (_ client.Image, retErr error) {
-	if !c.IsInitiated() {
-		return nil, errors.New(missInitErrMsg)
+	release, err := c.startWriteOp()
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
 	pOpt := &PullOpts{
 		aOpts: []ApplyCommitOpt{},
@@ -85,27 +143,69 @@ func (c *OCIStore) Pull(ref string, opts ...PullOpt) (_ client.Image, retErr err
 		rOpts = append(rOpts[:i], rOpts[i+1:]...)
 	}
 
-	ctx, done, err := c.cli.WithLease(c.ctx)
+	ctx, done, err := c.withLease(c.ctx)
 	if err != nil {
 		c.log.Errorf("failed to create lease to pull image: %v", err)
 		return nil, err
 	}
+	ingests := newPullIngests()
 	defer func() {
+		if retErr != nil && c.hasIngests(ctx, ingests) {
+			// The lease expires by itself, until then it keeps the partial downloads, so
+			// pulling again resumes them
+			c.log.Debugf("keeping lease of failed pull to resume its downloads")
+			return
+		}
 		err = done(ctx)
 		if err != nil && retErr == nil {
 			c.log.Warnf("could not remove lease on pull operation")
 		}
 	}()
 
-	img, err := c.cli.Pull(ctx, ref, rOpts...)
+	rOpts, err = c.remoteOpts(ref, pOpt.creds, rOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	rOpts = append(rOpts, client.WithImageHandler(ingests.handler()))
+	var progress *pullProgress
+	if pOpt.progress != nil {
+		progress = startPullProgress(ctx, c.cli.ContentStore(), ref, pOpt.progress)
+		rOpts = append(rOpts, client.WithImageHandler(progress.handler()))
+	}
+
+	var img client.Image
+	aOpts := pOpt.aOpts
+	err = c.withRetries(ctx, pOpt.retry, fmt.Sprintf("pull of image '%s'", ref), ingests, func() (err error) {
+		switch len(pOpt.platforms) {
+		case 0:
+			img, err = c.cli.Pull(ctx, ref, rOpts...)
+		case 1:
+			img, err = c.cli.Pull(ctx, ref, append(rOpts, client.WithPlatformMatcher(platforms.OnlyStrict(pOpt.platforms[0])))...)
+		default:
+			// Pull only fetches the best matching manifest, fetch does it for all of them
+			var i images.Image
+			i, err = c.cli.Fetch(ctx, ref, append(rOpts, client.WithPlatformMatcher(platforms.Any(pOpt.platforms...)))...)
+			if err == nil {
+				img = client.NewImageWithPlatform(c.cli, i, platforms.OnlyStrict(pOpt.platforms[0]))
+			}
+		}
+		return err
+	})
+	if progress != nil {
+		progress.finish()
+	}
 	if err != nil {
 		c.log.Errorf("failed to pull image '%s': %v", ref, err)
 		return nil, err
 	}
 	c.log.Infof("Successfully pulled image '%s'", img.Name())
 
+	if len(pOpt.platforms) > 0 {
+		aOpts = append([]ApplyCommitOpt{WithUnpackPlatform(pOpt.platforms[0])}, aOpts...)
+	}
 	if pOpt.unpack {
-		err = c.unpack(ctx, img, pOpt.aOpts...)
+		err = c.unpack(ctx, img, aOpts...)
 		if err != nil {
 			c.log.Errorf("failed to unpack image '%s': %v", img.Name(), err)
 		} else {
@@ -114,3 +214,28 @@ func (c *OCIStore) Pull(ref string, opts ...PullOpt) (_ client.Image, retErr err
 	}
 	return img, err
 }
+
+// remoteOpts prepends the resolver for the configured registry settings and credentials, so a
+// resolver given by the caller takes precedence. The given credentials, if any, are used for the
+// registry of ref.
+func (c *OCIStore) remoteOpts(ref string, creds *Credentials, rOpts []client.RemoteOpt) ([]client.RemoteOpt, error) {
+	credsFn := c.credentials
+	if credsFn == nil {
+		credsFn = DockerCredentials(c.registry.AuthFile)
+	}
+	if creds != nil {
+		var err error
+		credsFn, err = StaticCredentials(ref, *creds, credsFn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hostsDir := c.registry.ConfigPath
+	if hostsDir == "" {
+		hostsDir = filepath.Join(c.root, certsDir)
+	}
+
+	resolver := docker.NewResolver(docker.ResolverOptions{Hosts: c.registry.registryHosts(c.ctx, hostsDir, credsFn)})
+	return append([]client.RemoteOpt{client.WithResolver(resolver)}, rOpts...), nil
+}
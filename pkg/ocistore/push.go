@@ -0,0 +1,212 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/containerd/containerd/v2/client"
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/errdefs"
+	"github.com/containerd/platforms"
+	"github.com/distribution/reference"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+type PushOpts struct {
+	rOpts     []client.RemoteOpt
+	platform  *ocispec.Platform
+	remoteRef string
+	creds     *Credentials
+}
+
+type PushOpt func(*PushOpts) error
+
+func WithPushClientOpts(opts ...client.RemoteOpt) PushOpt {
+	return func(pOpts *PushOpts) error {
+		pOpts.rOpts = append(pOpts.rOpts, opts...)
+		return nil
+	}
+}
+
+// WithPushPlatform only pushes the manifest of the given platform, the remote image is a single
+// platform image. By default all platforms of the image are pushed.
+func WithPushPlatform(platform ocispec.Platform) PushOpt {
+	return func(pOpts *PushOpts) error {
+		pOpts.platform = &platform
+		return nil
+	}
+}
+
+// WithPushRemoteRef pushes the image to the given reference instead of the image name
+func WithPushRemoteRef(ref string) PushOpt {
+	return func(pOpts *PushOpts) error {
+		pOpts.remoteRef = ref
+		return nil
+	}
+}
+
+// WithPushCredentials authenticates against the remote registry with the given credentials
+// instead of the store ones
+func WithPushCredentials(creds Credentials) PushOpt {
+	return func(pOpts *PushOpts) error {
+		pOpts.creds = &creds
+		return nil
+	}
+}
+
+// Push uploads the given image to its registry, or to the remote reference if set. References
+// are normalized as docker does, so 'name:tag' is pushed to 'docker.io/library/name:tag'. Blobs
+// already in the registry are not uploaded again. Pushing all platforms fails before uploading
+// anything if the content of any of them is not in the store.
+func (c *OCIStore) Push(ref string, opts ...PushOpt) error {
+	release, err := c.startOp()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	pOpt := &PushOpts{
+		rOpts: []client.RemoteOpt{},
+	}
+	for _, o := range opts {
+		err := o(pOpt)
+		if err != nil {
+			return err
+		}
+	}
+
+	img, err := c.cli.ImageService().Get(c.ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	remote := img.Name
+	if pOpt.remoteRef != "" {
+		remote = pOpt.remoteRef
+	}
+	named, err := reference.ParseDockerRef(remote)
+	if err != nil {
+		return fmt.Errorf("invalid remote reference '%s': %w", remote, err)
+	}
+	remote = named.String()
+
+	rOpts, err := c.remoteOpts(remote, pOpt.creds, pOpt.rOpts)
+	if err != nil {
+		return err
+	}
+
+	desc := img.Target
+	if pOpt.platform == nil {
+		// Pushing an index requires the content of all its platforms, check it before
+		// uploading anything
+		missing, err := c.incompletePlatforms(c.ctx, img.Target)
+		if err != nil {
+			c.log.Errorf("failed to push image '%s': %v", ref, err)
+			return err
+		}
+		if len(missing) > 0 {
+			err = fmt.Errorf("image '%s' lacks the content of platform(s) %s, push a single platform instead (--single-platform): %w", ref, strings.Join(missing, ", "), errdefs.ErrFailedPrecondition)
+			c.log.Errorf("failed to push image '%s': %v", ref, err)
+			return err
+		}
+	} else {
+		desc, err = c.platformManifest(c.ctx, img.Target, *pOpt.platform)
+		if err != nil {
+			c.log.Errorf("failed to push image '%s': %v", ref, err)
+			return err
+		}
+		rOpts = append(rOpts, client.WithPlatformMatcher(platforms.OnlyStrict(*pOpt.platform)))
+	}
+
+	err = c.cli.Push(c.ctx, remote, desc, rOpts...)
+	if err != nil {
+		c.log.Errorf("failed to push image '%s' to '%s': %v", ref, remote, err)
+		return err
+	}
+
+	c.log.Infof("Successfully pushed image '%s' to '%s'", ref, remote)
+	return nil
+}
+
+// platformManifest returns the descriptor of the manifest of the given platform out of the
+// given image target
+func (c *OCIStore) platformManifest(ctx context.Context, target ocispec.Descriptor, platform ocispec.Platform) (ocispec.Descriptor, error) {
+	cs := c.cli.ContentStore()
+	matcher := platforms.OnlyStrict(platform)
+
+	if !images.IsIndexType(target.MediaType) {
+		mani := &ocispec.Manifest{}
+		if err := readJSONBlob(ctx, cs, target, mani); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		config := &ocispec.Image{}
+		if err := readJSONBlob(ctx, cs, mani.Config, config); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		if !matcher.Match(config.Platform) {
+			return ocispec.Descriptor{}, fmt.Errorf("image platform is '%s', not '%s': %w", platforms.Format(config.Platform), platforms.Format(platform), errdefs.ErrNotFound)
+		}
+		return target, nil
+	}
+
+	index := &ocispec.Index{}
+	if err := readJSONBlob(ctx, cs, target, index); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	for _, m := range index.Manifests {
+		if images.IsManifestType(m.MediaType) && m.Platform != nil && matcher.Match(*m.Platform) {
+			return m, nil
+		}
+	}
+	return ocispec.Descriptor{}, fmt.Errorf("no manifest for platform '%s': %w", platforms.Format(platform), errdefs.ErrNotFound)
+}
+
+// incompletePlatforms returns the platforms of the given index whose manifest, config or layers are
+// not in the content store, as images are only pulled or imported for the selected platforms
+func (c *OCIStore) incompletePlatforms(ctx context.Context, target ocispec.Descriptor) ([]string, error) {
+	if !images.IsIndexType(target.MediaType) {
+		return nil, nil
+	}
+	cs := c.cli.ContentStore()
+	index := &ocispec.Index{}
+	if err := readJSONBlob(ctx, cs, target, index); err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, m := range index.Manifests {
+		err := images.Walk(ctx, images.HandlerFunc(func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+			if _, err := cs.Info(ctx, desc.Digest); err != nil {
+				return nil, err
+			}
+			return images.Children(ctx, cs, desc)
+		}), m)
+		if errdefs.IsNotFound(err) {
+			name := m.Digest.String()
+			if m.Platform != nil {
+				name = platforms.Format(*m.Platform)
+			}
+			missing = append(missing, name)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
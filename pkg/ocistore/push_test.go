@@ -0,0 +1,90 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/containerd/errdefs"
+	"github.com/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestPushPlatforms(t *testing.T) {
+	host := platforms.DefaultSpec()
+	other := ocispec.Platform{OS: "linux", Architecture: "riscv64"}
+	if platforms.Only(host).Match(other) {
+		other.Architecture = "s390x"
+	}
+
+	reg := newTestRegistry(t, false)
+	cs := newTestStore(t, t.TempDir(), WithRegistryConfig(RegistryConfig{PlainHTTP: []string{reg.host()}}))
+	archive := writeTestArchive(t, "test/multi:latest", []ocispec.Platform{host, other}, testLayer{"file": "data"})
+
+	imgs, err := cs.ImportFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop the layers of the other platform, as if only the host one had been pulled
+	content := cs.cli.ContentStore()
+	index := &ocispec.Index{}
+	if err = readJSONBlob(cs.ctx, content, imgs[0].Target(), index); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range index.Manifests {
+		if !platforms.OnlyStrict(other).Match(*m.Platform) {
+			continue
+		}
+		mani := &ocispec.Manifest{}
+		if err = readJSONBlob(cs.ctx, content, m, mani); err != nil {
+			t.Fatal(err)
+		}
+		// The last layer is the only one not shared with the host platform
+		if err = content.Delete(cs.ctx, mani.Layers[len(mani.Layers)-1].Digest); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = cs.Push("test/multi:latest", WithPushRemoteRef(reg.host()+"/test/multi:latest"))
+	if !errdefs.IsFailedPrecondition(err) || !strings.Contains(err.Error(), platforms.Format(other)) {
+		t.Errorf("expected a failed precondition error about platform '%s', got: %v", platforms.Format(other), err)
+	}
+	if n := reg.manifestCount("test/multi"); n != 0 {
+		t.Errorf("expected nothing pushed, the registry has %d manifest(s)", n)
+	}
+
+	err = cs.Push("test/multi:latest", WithPushRemoteRef(reg.host()+"/test/single:latest"), WithPushPlatform(host))
+	if err != nil {
+		t.Fatalf("failed to push a single platform: %v", err)
+	}
+	if n := reg.manifestCount("test/single"); !reg.hasManifest("test/single:latest") || n != 1 {
+		t.Errorf("expected the single platform manifest to be pushed, the registry has %d manifest(s)", n)
+	}
+
+	// All platforms are pushed once their content is in the store
+	if _, err = cs.ImportFile(archive, WithImportPlatforms(host, other)); err != nil {
+		t.Fatal(err)
+	}
+	if err = cs.Push("test/multi:latest", WithPushRemoteRef(reg.host()+"/test/multi:latest")); err != nil {
+		t.Fatalf("failed to push all platforms: %v", err)
+	}
+	if n := reg.manifestCount("test/multi"); !reg.hasManifest("test/multi:latest") || n != 3 {
+		t.Errorf("expected the index and both manifests to be pushed, the registry has %d manifest(s)", n)
+	}
+}
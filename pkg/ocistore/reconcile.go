@@ -0,0 +1,316 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/leases"
+	"github.com/containerd/containerd/v2/core/mount"
+	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/errdefs"
+	"github.com/moby/sys/mountinfo"
+)
+
+const (
+	// LabelSnapshotPolicy sets what Reconcile does with the snapshot once it is no longer mounted
+	LabelSnapshotPolicy = "containerd.io/snapshot/recover.policy"
+
+	// PolicyKeep keeps abandoned snapshots, protecting them from garbage collection
+	PolicyKeep = "keep"
+	// PolicyDiscard removes abandoned snapshots and releases their data
+	PolicyDiscard = "discard"
+)
+
+// Actions taken by Reconcile on abandoned snapshots
+const (
+	ReconcileReported  = "reported"
+	ReconcileKept      = "kept"
+	ReconcileDiscarded = "discarded"
+)
+
+// ReconcileReport describes the stale state found by Reconcile and the actions taken, no action
+// is taken on dry runs
+type ReconcileReport struct {
+	DryRun bool
+	// StaleMounts are the mount records whose target is no longer mounted
+	StaleMounts []MountInfo
+	// Snapshots are the active snapshots or views no longer mounted
+	Snapshots []ReconciledSnapshot
+	// StaleLeases are the mount leases whose snapshot no longer exists
+	StaleLeases []string
+}
+
+// ReconciledSnapshot is an abandoned snapshot and the action taken by Reconcile
+type ReconciledSnapshot struct {
+	Key    string
+	Kind   snapshots.Kind
+	Target string
+	Policy string
+	Action string
+}
+
+type ReconcileOpts struct {
+	dryRun        bool
+	defaultPolicy string
+}
+
+type ReconcileOpt func(*ReconcileOpts) error
+
+// WithReconcileDryRun reports the stale state without changing anything
+func WithReconcileDryRun() ReconcileOpt {
+	return func(rOpts *ReconcileOpts) error {
+		rOpts.dryRun = true
+		return nil
+	}
+}
+
+// WithReconcileDefaultPolicy sets the policy of abandoned snapshots not labelled with
+// LabelSnapshotPolicy. By default they are only reported and released once their lease expires.
+func WithReconcileDefaultPolicy(policy string) ReconcileOpt {
+	return func(rOpts *ReconcileOpts) error {
+		if err := validatePolicy(policy); err != nil {
+			return err
+		}
+		rOpts.defaultPolicy = policy
+		return nil
+	}
+}
+
+// WithMountPolicy labels the mounted snapshot with the given policy, see Reconcile
+func WithMountPolicy(policy string) MountOpt {
+	return func(mOpts *MountOpts) error {
+		if err := validatePolicy(policy); err != nil {
+			return err
+		}
+		mOpts.sOpts = append(mOpts.sOpts, snapshots.WithLabels(map[string]string{LabelSnapshotPolicy: policy}))
+		return nil
+	}
+}
+
+// Reconcile cross-checks the mount records, the active snapshots and views and the mount leases of
+// the store namespace against the current mounts of the system. Records of targets no longer
+// mounted and leases of snapshots no longer existing are removed. Snapshots no longer mounted are
+// kept or discarded according to their LabelSnapshotPolicy label, discarded snapshots are
+// released right away.
+func (c *OCIStore) Reconcile(opts ...ReconcileOpt) (*ReconcileReport, error) {
+	rOpt := &ReconcileOpts{}
+	for _, o := range opts {
+		err := o(rOpt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	startOp := c.startWriteOp
+	if rOpt.dryRun {
+		startOp = c.startOp
+	}
+	release, err := startOp()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	report, err := c.reconcile(c.ctx, rOpt)
+	if err != nil {
+		c.log.Errorf("failed to reconcile store with system mounts: %v", err)
+		return nil, err
+	}
+	return report, nil
+}
+
+func (c *OCIStore) reconcile(ctx context.Context, rOpt *ReconcileOpts) (*ReconcileReport, error) {
+	report := &ReconcileReport{DryRun: rOpt.dryRun}
+
+	sysMounts, err := mountinfo.GetMounts(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read system mounts: %w", err)
+	}
+	mounted := map[string]bool{}
+	for _, m := range sysMounts {
+		mounted[m.Mountpoint] = true
+	}
+
+	records, err := c.listMountRecords()
+	if err != nil {
+		return nil, err
+	}
+	// inUse maps the snapshot keys of mounted targets
+	inUse := map[string]bool{}
+	targets := map[string]string{}
+	for _, r := range records {
+		targets[r.Key] = r.Target
+		// Records used to be stored without resolving symlinks, mount points are resolved
+		if mounted[r.Target] || mounted[resolveTarget(r.Target)] {
+			inUse[r.Key] = true
+			continue
+		}
+		report.StaleMounts = append(report.StaleMounts, r)
+		if !rOpt.dryRun {
+			if err = c.removeMount(r.Target); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sn := c.cli.SnapshotService(c.driver)
+	infos, err := listSnapshots(ctx, sn)
+	if err != nil && !errdefs.IsNotFound(err) {
+		return nil, err
+	}
+
+	var discarded bool
+	existing := map[string]bool{}
+	for _, info := range infos {
+		existing[info.Name] = true
+		if info.Kind == snapshots.KindCommitted || inUse[info.Name] {
+			continue
+		}
+
+		// Snapshots mounted somewhere else than their recorded target, by other means or
+		// before mounts were recorded
+		sMounts, err := sn.Mounts(ctx, info.Name)
+		if err != nil {
+			return nil, err
+		}
+		if snapshotMounted(sMounts, sysMounts) {
+			continue
+		}
+
+		rs := ReconciledSnapshot{
+			Key: info.Name, Kind: info.Kind, Target: targets[info.Name],
+			Policy: info.Labels[LabelSnapshotPolicy], Action: ReconcileReported,
+		}
+		if rs.Policy == "" {
+			rs.Policy = rOpt.defaultPolicy
+		}
+
+		switch rs.Policy {
+		case PolicyKeep:
+			// Already kept by a former run
+			if _, ok := info.Labels["containerd.io/gc.root"]; ok && targets[info.Name] == "" {
+				continue
+			}
+			rs.Action = ReconcileKept
+			if !rOpt.dryRun {
+				labels := map[string]string{"containerd.io/gc.root": time.Now().UTC().Format(time.RFC3339)}
+				if _, err = c.labelSnapshot(ctx, info, labels); err != nil {
+					return nil, fmt.Errorf("failed to keep snapshot '%s': %w", info.Name, err)
+				}
+			}
+		case PolicyDiscard:
+			rs.Action = ReconcileDiscarded
+			if !rOpt.dryRun {
+				err = c.cli.LeasesService().Delete(ctx, leases.Lease{ID: info.Name})
+				if err != nil && !errdefs.IsNotFound(err) {
+					return nil, fmt.Errorf("failed to delete lease of snapshot '%s': %w", info.Name, err)
+				}
+				if err = sn.Remove(ctx, info.Name); err != nil {
+					return nil, fmt.Errorf("failed to discard snapshot '%s': %w", info.Name, err)
+				}
+				existing[info.Name] = false
+				discarded = true
+			}
+		}
+		report.Snapshots = append(report.Snapshots, rs)
+	}
+
+	// Mount leases are named after their snapshot and reference it
+	ls, err := c.cli.LeasesService().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range ls {
+		key, ok := l.Labels["containerd.io/gc.ref.snapshot."+c.driver]
+		if !ok || key != l.ID || existing[key] {
+			continue
+		}
+		report.StaleLeases = append(report.StaleLeases, l.ID)
+		if !rOpt.dryRun {
+			err = c.cli.LeasesService().Delete(ctx, l)
+			if err != nil && !errdefs.IsNotFound(err) {
+				return nil, err
+			}
+		}
+	}
+
+	if discarded {
+		if _, err = c.garbageCollect(ctx, false); err != nil {
+			c.log.Warnf("failed to release discarded snapshots: %v", err)
+		}
+	}
+	return report, nil
+}
+
+// snapshotMounted checks whether any of the system mounts uses the given snapshot mounts. Overlay
+// mounts are identified by their upper directory, read-only overlay views by their lower
+// directories, bind mounts by their source path and btrfs mounts by their subvolume. Views of
+// the same parent share their lower directories, those are all considered mounted if any is.
+func snapshotMounted(sMounts []mount.Mount, sysMounts []*mountinfo.Info) bool {
+	for _, m := range sMounts {
+		for _, sm := range sysMounts {
+			if mountUses(m, sm) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mountUses checks whether the system mount sm is the mount of the snapshot mount m
+func mountUses(m mount.Mount, sm *mountinfo.Info) bool {
+	vfsOpts := "," + sm.VFSOptions + ","
+	switch {
+	case m.Type == "overlay" && sm.FSType == "overlay":
+		var upper, lower string
+		for _, opt := range m.Options {
+			if v, ok := strings.CutPrefix(opt, "upperdir="); ok {
+				upper = v
+			} else if v, ok := strings.CutPrefix(opt, "lowerdir="); ok {
+				lower = v
+			}
+		}
+		if upper != "" {
+			return strings.Contains(vfsOpts, ",upperdir="+upper+",")
+		}
+		return lower != "" && strings.Contains(vfsOpts, ",lowerdir="+lower+",") &&
+			!strings.Contains(vfsOpts, ",upperdir=")
+	case m.Type == "bind":
+		return sm.Root != "/" && strings.HasSuffix(m.Source, sm.Root)
+	case m.Type == "btrfs" && sm.FSType == "btrfs":
+		if m.Source != sm.Source {
+			return false
+		}
+		for _, opt := range m.Options {
+			if strings.HasPrefix(opt, "subvolid=") {
+				return strings.Contains(vfsOpts, ","+opt+",")
+			}
+		}
+	}
+	return false
+}
+
+func validatePolicy(policy string) error {
+	if policy != PolicyKeep && policy != PolicyDiscard {
+		return fmt.Errorf("invalid snapshot policy '%s', expected '%s' or '%s': %w", policy, PolicyKeep, PolicyDiscard, errdefs.ErrInvalidArgument)
+	}
+	return nil
+}
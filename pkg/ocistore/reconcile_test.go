@@ -0,0 +1,190 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd/v2/core/mount"
+	"github.com/containerd/errdefs"
+	"github.com/moby/sys/mountinfo"
+	"golang.org/x/sys/unix"
+)
+
+func TestSnapshotMounted(t *testing.T) {
+	const snDir = "/store/snapshots/snapshots"
+	active := []mount.Mount{{
+		Type: "overlay", Source: "overlay",
+		Options: []string{"index=off", "workdir=" + snDir + "/3/work", "upperdir=" + snDir + "/3/fs", "lowerdir=" + snDir + "/2/fs:" + snDir + "/1/fs"},
+	}}
+	view := []mount.Mount{{
+		Type: "overlay", Source: "overlay",
+		Options: []string{"index=off", "ro", "lowerdir=" + snDir + "/2/fs:" + snDir + "/1/fs"},
+	}}
+	bind := []mount.Mount{{Type: "bind", Source: snDir + "/1/fs", Options: []string{"ro", "rbind"}}}
+	btrfs := []mount.Mount{{Type: "btrfs", Source: "/dev/vdb", Options: []string{"subvolid=258", "ro"}}}
+
+	overlayInfo := func(opts string) *mountinfo.Info {
+		return &mountinfo.Info{Mountpoint: "/mnt", FSType: "overlay", Source: "overlay", Root: "/", VFSOptions: "rw,index=off," + opts}
+	}
+	for name, tc := range map[string]struct {
+		sMounts []mount.Mount
+		sys     *mountinfo.Info
+		mounted bool
+	}{
+		"active overlay": {
+			active, overlayInfo("lowerdir=" + snDir + "/2/fs:" + snDir + "/1/fs,upperdir=" + snDir + "/3/fs,workdir=" + snDir + "/3/work"), true,
+		},
+		"active overlay of another upperdir": {
+			active, overlayInfo("lowerdir=" + snDir + "/2/fs:" + snDir + "/1/fs,upperdir=" + snDir + "/4/fs,workdir=" + snDir + "/4/work"), false,
+		},
+		"overlay view": {
+			view, overlayInfo("lowerdir=" + snDir + "/2/fs:" + snDir + "/1/fs"), true,
+		},
+		"overlay view of another parent": {
+			view, overlayInfo("lowerdir=" + snDir + "/2/fs:" + snDir + "/1/fs:" + snDir + "/0/fs"), false,
+		},
+		"overlay view next to an active snapshot of the same parent": {
+			view, overlayInfo("lowerdir=" + snDir + "/2/fs:" + snDir + "/1/fs,upperdir=" + snDir + "/3/fs,workdir=" + snDir + "/3/work"), false,
+		},
+		"bind": {
+			bind, &mountinfo.Info{Mountpoint: "/mnt", FSType: "ext4", Source: "/dev/vda", Root: snDir + "/1/fs", VFSOptions: "rw"}, true,
+		},
+		"bind of another snapshot": {
+			bind, &mountinfo.Info{Mountpoint: "/mnt", FSType: "ext4", Source: "/dev/vda", Root: snDir + "/11/fs", VFSOptions: "rw"}, false,
+		},
+		"bind compared to a filesystem root": {
+			bind, &mountinfo.Info{Mountpoint: "/", FSType: "ext4", Source: "/dev/vda", Root: "/", VFSOptions: "rw"}, false,
+		},
+		"btrfs subvolume": {
+			btrfs, &mountinfo.Info{Mountpoint: "/mnt", FSType: "btrfs", Source: "/dev/vdb", Root: "/snapshots/5", VFSOptions: "ro,relatime,space_cache=v2,subvolid=258,subvol=/snapshots/5"}, true,
+		},
+		"btrfs subvolume with a common prefix": {
+			btrfs, &mountinfo.Info{Mountpoint: "/mnt", FSType: "btrfs", Source: "/dev/vdb", Root: "/snapshots/50", VFSOptions: "ro,relatime,subvolid=2580,subvol=/snapshots/50"}, false,
+		},
+		"btrfs subvolume of another device": {
+			btrfs, &mountinfo.Info{Mountpoint: "/mnt", FSType: "btrfs", Source: "/dev/vdc", Root: "/snapshots/5", VFSOptions: "ro,relatime,subvolid=258,subvol=/snapshots/5"}, false,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := snapshotMounted(tc.sMounts, []*mountinfo.Info{tc.sys}); got != tc.mounted {
+				t.Errorf("expected mounted to be %v, got %v", tc.mounted, got)
+			}
+		})
+	}
+}
+
+func TestReconcileMounts(t *testing.T) {
+	requireRoot(t)
+	cs := newTestStore(t, t.TempDir(), WithDriver(OverlayDriver))
+
+	// Every case mounts its own image, views of the same image can't be told apart. Images have
+	// two layers, so views are read-only overlay mounts instead of bind mounts.
+	mountCase := func(name, target string, readonly bool) string {
+		t.Helper()
+		ref := "test/" + name + ":latest"
+		importTestImage(t, cs, ref, testLayer{"name": name}, testLayer{"data": "data"})
+		img, err := cs.Get(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = cs.Unpack(img); err != nil {
+			t.Fatal(err)
+		}
+		key, err := cs.Mount(img, target, name, readonly)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = mount.UnmountAll(target, 0) })
+		return key
+	}
+
+	// Mounted through a symlink, recorded with its resolved path
+	link := filepath.Join(t.TempDir(), "link")
+	realTarget := t.TempDir()
+	if err := os.Symlink(realTarget, link); err != nil {
+		t.Fatal(err)
+	}
+	linked := mountCase("linked", link, true)
+	t.Cleanup(func() { _ = mount.UnmountAll(realTarget, 0) })
+	if info, err := cs.GetMount(link); err != nil || info.Target != realTarget {
+		t.Errorf("expected mount recorded for '%s', got %+v: %v", realTarget, info, err)
+	}
+
+	// Mounted view without record, e.g. mounted by other means
+	target := t.TempDir()
+	unrecorded := mountCase("unrecorded", target, true)
+	if err := cs.removeMount(target); err != nil {
+		t.Fatal(err)
+	}
+
+	// Recorded target no longer mounted while the snapshot is mounted somewhere else
+	target = t.TempDir()
+	moved := mountCase("moved", target, false)
+	elsewhere := t.TempDir()
+	if err := unix.Mount(target, elsewhere, "", unix.MS_MOVE, ""); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = mount.UnmountAll(elsewhere, 0) })
+
+	// Abandoned views, unmounted without the store
+	target = t.TempDir()
+	abandoned := mountCase("abandoned", target, true)
+	if err := mount.UnmountAll(target, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := cs.Reconcile(WithReconcileDefaultPolicy(PolicyDiscard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stale []string
+	for _, m := range report.StaleMounts {
+		stale = append(stale, m.Key)
+	}
+	if len(stale) != 2 || !containsAll(stale, moved, abandoned) {
+		t.Errorf("expected stale mounts of '%s' and '%s', got %v", moved, abandoned, stale)
+	}
+	if len(report.Snapshots) != 1 || report.Snapshots[0].Key != abandoned || report.Snapshots[0].Action != ReconcileDiscarded {
+		t.Errorf("expected only '%s' to be discarded, got %+v", abandoned, report.Snapshots)
+	}
+
+	sn := cs.cli.SnapshotService(cs.driver)
+	for _, key := range []string{linked, unrecorded, moved} {
+		if _, err = sn.Stat(cs.ctx, key); err != nil {
+			t.Errorf("mounted snapshot '%s' was not kept: %v", key, err)
+		}
+	}
+	if _, err = sn.Stat(cs.ctx, abandoned); !errdefs.IsNotFound(err) {
+		t.Errorf("expected abandoned snapshot to be discarded, got: %v", err)
+	}
+}
+
+func containsAll(list []string, items ...string) bool {
+	for _, item := range items {
+		found := false
+		for _, l := range list {
+			found = found || l == item
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
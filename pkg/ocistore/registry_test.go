@@ -0,0 +1,307 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// testRegistry is a minimal in-memory registry implementing the distribution API used to pull
+// and push images
+type testRegistry struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	blobs     map[digest.Digest][]byte
+	manifests map[string]testManifest
+	uploads   map[string][]byte
+	requests  []*http.Request
+
+	// intercept handles the request instead of the registry if it returns true
+	intercept func(w http.ResponseWriter, r *http.Request) bool
+}
+
+type testManifest struct {
+	mediaType string
+	data      []byte
+}
+
+// newTestRegistry starts a registry served over plain HTTP, or over HTTPS with a self-signed
+// certificate if secure is set. It is closed at the end of the test.
+func newTestRegistry(t *testing.T, secure bool) *testRegistry {
+	t.Helper()
+	reg := &testRegistry{
+		blobs:     map[digest.Digest][]byte{},
+		manifests: map[string]testManifest{},
+		uploads:   map[string][]byte{},
+	}
+	reg.Server = httptest.NewUnstartedServer(reg)
+	if secure {
+		reg.StartTLS()
+	} else {
+		reg.Start()
+	}
+	t.Cleanup(reg.Close)
+	return reg
+}
+
+// host returns the registry host as used in image references
+func (reg *testRegistry) host() string {
+	_, host, _ := strings.Cut(reg.URL, "://")
+	return host
+}
+
+func (reg *testRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reg.mu.Lock()
+	reg.requests = append(reg.requests, r.Clone(r.Context()))
+	intercept := reg.intercept
+	reg.mu.Unlock()
+	if intercept != nil && intercept(w, r) {
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	if path == "" {
+		return
+	}
+	if i := strings.LastIndex(path, "/blobs/uploads/"); i >= 0 {
+		reg.upload(w, r, path[:i], strings.TrimPrefix(path[i:], "/blobs/uploads/"))
+		return
+	}
+	if i := strings.LastIndex(path, "/blobs/"); i >= 0 {
+		reg.blob(w, r, digest.Digest(path[i+len("/blobs/"):]))
+		return
+	}
+	if i := strings.LastIndex(path, "/manifests/"); i >= 0 {
+		reg.manifest(w, r, path[:i], path[i+len("/manifests/"):])
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func (reg *testRegistry) blob(w http.ResponseWriter, r *http.Request, dgst digest.Digest) {
+	reg.mu.Lock()
+	data, ok := reg.blobs[dgst]
+	reg.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Docker-Content-Digest", dgst.String())
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+func (reg *testRegistry) upload(w http.ResponseWriter, r *http.Request, name, id string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if r.Method == http.MethodPost {
+		id = fmt.Sprintf("%d", len(reg.uploads))
+		reg.uploads[id] = nil
+		w.Header().Set("Location", "/v2/"+name+"/blobs/uploads/"+id)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	data, ok := reg.uploads[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data = append(data, body...)
+	reg.uploads[id] = data
+
+	switch r.Method {
+	case http.MethodPatch:
+		w.Header().Set("Location", r.URL.Path)
+		w.Header().Set("Range", fmt.Sprintf("0-%d", len(data)-1))
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		dgst := digest.Digest(r.URL.Query().Get("digest"))
+		if dgst != digest.FromBytes(data) {
+			http.Error(w, "digest mismatch", http.StatusBadRequest)
+			return
+		}
+		delete(reg.uploads, id)
+		reg.blobs[dgst] = data
+		w.Header().Set("Docker-Content-Digest", dgst.String())
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (reg *testRegistry) manifest(w http.ResponseWriter, r *http.Request, name, ref string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if r.Method == http.MethodPut {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m := testManifest{mediaType: r.Header.Get("Content-Type"), data: data}
+		dgst := digest.FromBytes(data)
+		reg.manifests[name+"@"+dgst.String()] = m
+		if _, err = digest.Parse(ref); err != nil {
+			reg.manifests[name+":"+ref] = m
+		}
+		w.Header().Set("Docker-Content-Digest", dgst.String())
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	key := name + ":" + ref
+	if _, err := digest.Parse(ref); err == nil {
+		key = name + "@" + ref
+	}
+	m, ok := reg.manifests[key]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", m.mediaType)
+	w.Header().Set("Docker-Content-Digest", digest.FromBytes(m.data).String())
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(m.data)))
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(m.data)
+	}
+}
+
+// hasManifest reports whether the registry holds the given manifest reference, as 'name:tag' or
+// 'name@digest'
+func (reg *testRegistry) hasManifest(ref string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	_, ok := reg.manifests[ref]
+	return ok
+}
+
+// manifestCount returns the number of manifests of the given repository
+func (reg *testRegistry) manifestCount(name string) int {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	var n int
+	for ref := range reg.manifests {
+		if strings.HasPrefix(ref, name+"@") {
+			n++
+		}
+	}
+	return n
+}
+
+// pushTestImage pushes an image with the given layers to the registry from a throwaway store and
+// returns its remote reference
+func pushTestImage(t *testing.T, reg *testRegistry, name string, layers ...testLayer) string {
+	t.Helper()
+	cs := newTestStore(t, t.TempDir(), WithRegistryConfig(RegistryConfig{PlainHTTP: []string{reg.host()}}))
+	importTestImage(t, cs, name, layers...)
+	remote := reg.host() + "/" + name
+	if err := cs.Push(name, WithPushRemoteRef(remote)); err != nil {
+		t.Fatalf("failed to push '%s': %v", remote, err)
+	}
+	return remote
+}
+
+// slowBlob intercepts downloads of the given blob to send it in two halves, pausing in between
+func (reg *testRegistry) slowBlob(dgst digest.Digest, pause time.Duration) func(http.ResponseWriter, *http.Request) bool {
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodGet || !strings.HasSuffix(r.URL.Path, "/blobs/"+dgst.String()) {
+			return false
+		}
+		reg.mu.Lock()
+		data := reg.blobs[dgst]
+		reg.mu.Unlock()
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+		w.Header().Set("Docker-Content-Digest", dgst.String())
+		_, _ = w.Write(data[:len(data)/2])
+		w.(http.Flusher).Flush()
+		time.Sleep(pause)
+		_, _ = w.Write(data[len(data)/2:])
+		return true
+	}
+}
+
+// largestBlob returns the digest of the largest blob in the registry
+func (reg *testRegistry) largestBlob() digest.Digest {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	var largest digest.Digest
+	for d, b := range reg.blobs {
+		if largest == "" || len(b) > len(reg.blobs[largest]) {
+			largest = d
+		}
+	}
+	return largest
+}
+
+// dropBlob intercepts the first n downloads of the given blob to close the connection once half
+// of it is sent, as a broken network would
+func (reg *testRegistry) dropBlob(dgst digest.Digest, n int) func(http.ResponseWriter, *http.Request) bool {
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodGet || !strings.HasSuffix(r.URL.Path, "/blobs/"+dgst.String()) {
+			return false
+		}
+		reg.mu.Lock()
+		data := reg.blobs[dgst]
+		drop := n > 0
+		n--
+		reg.mu.Unlock()
+		if !drop {
+			return false
+		}
+
+		conn, bufrw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return false
+		}
+		defer conn.Close()
+		fmt.Fprintf(bufrw, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\nDocker-Content-Digest: %s\r\n\r\n", len(data), dgst)
+		_, _ = bufrw.Write(data[:len(data)/2])
+		_ = bufrw.Flush()
+		return true
+	}
+}
+
+// blobRanges returns the Range headers of the downloads of the given blob
+func (reg *testRegistry) blobRanges(dgst digest.Digest) []string {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	var ranges []string
+	for _, r := range reg.requests {
+		if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/blobs/"+dgst.String()) {
+			ranges = append(ranges, r.Header.Get("Range"))
+		}
+	}
+	return ranges
+}
@@ -0,0 +1,191 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/containerd/v2/core/remotes"
+	remoteerrors "github.com/containerd/containerd/v2/core/remotes/errors"
+	"github.com/containerd/errdefs"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	DefaultRetryBackoff    = 1 * time.Second
+	DefaultRetryMaxBackoff = 30 * time.Second
+)
+
+// RetryPolicy sets how a registry operation failing with a transient error is retried. The delay
+// between attempts starts at InitialBackoff and doubles on every retry up to MaxBackoff, zero
+// durations take the defaults.
+type RetryPolicy struct {
+	Retries        int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// withRetries calls fn until it succeeds, it fails with a non transient error or the retries of
+// the policy are exhausted. Downloads resume from the offset of their unfinished ingests, so
+// retrying a fetch does not download again the content already written.
+func (c *OCIStore) withRetries(ctx context.Context, policy RetryPolicy, op string, ingests *pullIngests, fn func() error) error {
+	backoff := policy.InitialBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	maxBackoff := policy.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultRetryMaxBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt > policy.Retries || ctx.Err() != nil || !isTransientError(err) {
+			return err
+		}
+
+		if isCommitMismatch(err) {
+			// The downloaded data does not match its digest, resuming would fail again
+			c.abortCompleteIngests(ctx, ingests)
+		}
+		c.log.Warnf("%s failed, retrying in %s (%d/%d): %v", op, backoff, attempt, policy.Retries, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// isTransientError reports whether the given registry error is worth a retry: network errors,
+// connections closed early, server errors, throttling and corrupted downloads
+func isTransientError(err error) bool {
+	var statusErr remoteerrors.ErrUnexpectedStatus
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError ||
+			statusErr.StatusCode == http.StatusTooManyRequests ||
+			statusErr.StatusCode == http.StatusRequestTimeout
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.EPIPE),
+		isCommitMismatch(err):
+		return true
+	}
+	return false
+}
+
+// commitMismatchErrors are the messages of the content store errors committing data that does
+// not match the digest or size of its descriptor
+var commitMismatchErrors = []string{
+	"unexpected commit digest", "unexpected commit size", "unexpected digest", "failed size validation",
+}
+
+// isCommitMismatch reports whether the given error is a commit of data not matching its descriptor,
+// other failed preconditions, such as commits on closed writers, are not download errors
+func isCommitMismatch(err error) bool {
+	if !errdefs.IsFailedPrecondition(err) {
+		return false
+	}
+	for _, msg := range commitMismatchErrors {
+		if strings.Contains(err.Error(), msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// pullIngests records the ingest references of the descriptors fetched by a pull, so a failed
+// pull only deals with its own unfinished downloads and not with the ones of concurrent pulls
+type pullIngests struct {
+	mu   sync.Mutex
+	refs map[string]bool
+}
+
+func newPullIngests() *pullIngests {
+	return &pullIngests{refs: map[string]bool{}}
+}
+
+// handler records every descriptor dispatched by the fetch
+func (p *pullIngests) handler() images.Handler {
+	return images.HandlerFunc(func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.refs[remotes.MakeRefKey(ctx, desc)] = true
+		return nil, nil
+	})
+}
+
+// statuses returns the unfinished ingests of the pull
+func (p *pullIngests) statuses(ctx context.Context, cs content.Store) ([]content.Status, error) {
+	statuses, err := cs.ListStatuses(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var own []content.Status
+	for _, st := range statuses {
+		if p.refs[st.Ref] {
+			own = append(own, st)
+		}
+	}
+	return own, nil
+}
+
+// hasIngests reports whether the pull left unfinished downloads
+func (c *OCIStore) hasIngests(ctx context.Context, ingests *pullIngests) bool {
+	statuses, err := ingests.statuses(ctx, c.cli.ContentStore())
+	return err == nil && len(statuses) > 0
+}
+
+// abortCompleteIngests removes the ingests of the pull holding all the expected data that could
+// not be committed, so they are downloaded from scratch
+func (c *OCIStore) abortCompleteIngests(ctx context.Context, ingests *pullIngests) {
+	cs := c.cli.ContentStore()
+	statuses, err := ingests.statuses(ctx, cs)
+	if err != nil {
+		c.log.Warnf("failed to list ingests: %v", err)
+		return
+	}
+	for _, st := range statuses {
+		if st.Total > 0 && st.Offset >= st.Total {
+			c.log.Debugf("aborting ingest '%s'", st.Ref)
+			if err = cs.Abort(ctx, st.Ref); err != nil && !errdefs.IsNotFound(err) {
+				c.log.Warnf("failed to abort ingest '%s': %v", st.Ref, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/leases"
+	remoteerrors "github.com/containerd/containerd/v2/core/remotes/errors"
+	"github.com/containerd/errdefs"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestIsTransientError(t *testing.T) {
+	status := func(code int) error {
+		return fmt.Errorf("fetch failed: %w", remoteerrors.ErrUnexpectedStatus{StatusCode: code})
+	}
+	for name, tc := range map[string]struct {
+		err       error
+		transient bool
+	}{
+		"server error":       {status(http.StatusInternalServerError), true},
+		"unavailable":        {status(http.StatusServiceUnavailable), true},
+		"throttled":          {status(http.StatusTooManyRequests), true},
+		"timeout":            {status(http.StatusRequestTimeout), true},
+		"not found":          {status(http.StatusNotFound), false},
+		"unauthorized":       {status(http.StatusUnauthorized), false},
+		"network":            {&net.OpError{Op: "dial", Err: errors.New("no route to host")}, true},
+		"unexpected EOF":     {fmt.Errorf("read failed: %w", io.ErrUnexpectedEOF), true},
+		"connection reset":   {fmt.Errorf("read failed: %w", syscall.ECONNRESET), true},
+		"refused":            {fmt.Errorf("dial failed: %w", syscall.ECONNREFUSED), true},
+		"broken pipe":        {fmt.Errorf("write failed: %w", syscall.EPIPE), true},
+		"commit digest":      {fmt.Errorf("unexpected commit digest sha256:a, expected sha256:b: %w", errdefs.ErrFailedPrecondition), true},
+		"commit size":        {fmt.Errorf("unexpected commit size 1, expected 2: %w", errdefs.ErrFailedPrecondition), true},
+		"closed writer":      {fmt.Errorf("cannot commit on closed writer: %w", errdefs.ErrFailedPrecondition), false},
+		"other precondition": {fmt.Errorf("snapshot is in use: %w", errdefs.ErrFailedPrecondition), false},
+		"content not found":  {fmt.Errorf("content: %w", errdefs.ErrNotFound), false},
+		"plain":              {errors.New("invalid manifest"), false},
+	} {
+		if got := isTransientError(tc.err); got != tc.transient {
+			t.Errorf("%s: expected transient %v, got %v", name, tc.transient, got)
+		}
+	}
+}
+
+func TestPullResume(t *testing.T) {
+	reg := newTestRegistry(t, false)
+	remote := pushTestImage(t, reg, "test/resume:latest", testLargeLayer(t, 3<<20))
+	large := reg.largestBlob()
+	reg.intercept = reg.dropBlob(large, 1)
+
+	cs := newTestStore(t, t.TempDir(), WithRegistryConfig(RegistryConfig{PlainHTTP: []string{reg.host()}}))
+	_, err := cs.Pull(remote, WithPullRetry(RetryPolicy{Retries: 1, InitialBackoff: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatalf("pull not retried: %v", err)
+	}
+
+	// The retry resumes from the data already written
+	ranges := reg.blobRanges(large)
+	if len(ranges) != 2 || ranges[0] != "" {
+		t.Fatalf("expected the layer to be downloaded twice, got ranges %q", ranges)
+	}
+	offset, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(ranges[1], "bytes="), "-"))
+	if err != nil || offset <= 0 {
+		t.Errorf("expected the download to resume, got range '%s'", ranges[1])
+	}
+
+	statuses, err := cs.cli.ContentStore().ListStatuses(cs.ctx)
+	if err != nil || len(statuses) > 0 {
+		t.Errorf("expected no ingests left, got %v, %v", statuses, err)
+	}
+}
+
+func TestPullIngestsScope(t *testing.T) {
+	reg := newTestRegistry(t, false)
+	remote := pushTestImage(t, reg, "test/scope:latest", testLargeLayer(t, 64*1024))
+	cs := newTestStore(t, t.TempDir(), WithRegistryConfig(RegistryConfig{PlainHTTP: []string{reg.host()}}))
+
+	// Unfinished ingests of someone else, one of them holding all its data
+	ctx, _, err := cs.withLease(cs.ctx, leases.WithID("foreign"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ref, size := range map[string]int64{"foreign-partial": 8, "foreign-complete": 4} {
+		desc := ocispec.Descriptor{Digest: digest.FromString(ref), Size: size}
+		w, err := cs.cli.ContentStore().Writer(ctx, content.WithRef(ref), content.WithDescriptor(desc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte("data")); err != nil {
+			t.Fatal(err)
+		}
+		_ = w.Close()
+	}
+	foreign := func() {
+		t.Helper()
+		statuses, err := cs.cli.ContentStore().ListStatuses(cs.ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var refs []string
+		for _, st := range statuses {
+			refs = append(refs, st.Ref)
+		}
+		if len(refs) != 2 || !containsAll(refs, "foreign-partial", "foreign-complete") {
+			t.Errorf("expected only the foreign ingests, got %v", refs)
+		}
+	}
+	pullLeases := func() int {
+		t.Helper()
+		ls, err := cs.cli.LeasesService().List(cs.ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(ls) - 1
+	}
+
+	// Corrupted downloads are aborted and downloaded again, other ingests are left alone
+	large := reg.largestBlob()
+	var corrupted bool
+	reg.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if corrupted || r.Method != http.MethodGet || !strings.HasSuffix(r.URL.Path, "/blobs/"+large.String()) {
+			return false
+		}
+		corrupted = true
+		reg.mu.Lock()
+		data := slices.Clone(reg.blobs[large])
+		reg.mu.Unlock()
+		data[0] ^= 0xff
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		_, _ = w.Write(data)
+		return true
+	}
+	if _, err = cs.Pull(remote, WithPullRetry(RetryPolicy{Retries: 1, InitialBackoff: 10 * time.Millisecond})); err != nil {
+		t.Fatalf("corrupted download not retried: %v", err)
+	}
+	if !corrupted {
+		t.Fatal("download not corrupted")
+	}
+	foreign()
+	if n := pullLeases(); n != 0 {
+		t.Errorf("expected the pull lease to be released, got %d", n)
+	}
+
+	// Failed pulls not leaving ingests of their own release their lease
+	reg.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		w.WriteHeader(http.StatusNotFound)
+		return true
+	}
+	if _, err = cs.Pull(reg.host() + "/test/missing:latest"); err == nil {
+		t.Fatal("expected pull of a missing image to fail")
+	}
+	foreign()
+	if n := pullLeases(); n != 0 {
+		t.Errorf("expected the lease of the failed pull to be released, got %d", n)
+	}
+}
@@ -18,7 +18,6 @@ package ocistore
 
 import (
 	"context"
-	"errors"
 	"fmt"
 
 	"github.com/containerd/containerd/v2/core/snapshots"
@@ -26,11 +25,13 @@ import (
 )
 
 func (c *OCIStore) ListSnapshots(filters ...string) (_ []snapshots.Info, retErr error) {
-	if !c.IsInitiated() {
-		return nil, errors.New(missInitErrMsg)
+	release, err := c.startOp()
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
-	ctx, done, err := c.cli.WithLease(c.ctx)
+	ctx, done, err := c.withLease(c.ctx)
 	if err != nil {
 		c.log.Errorf("failed to create lease to list snapshots: %v", err)
 		return nil, err
@@ -55,11 +56,13 @@ func (c *OCIStore) ListSnapshots(filters ...string) (_ []snapshots.Info, retErr
 
 func (c *OCIStore) GetSnapshot(key string) (_ snapshots.Info, retErr error) {
 	var info snapshots.Info
-	if !c.IsInitiated() {
-		return info, errors.New(missInitErrMsg)
+	release, err := c.startOp()
+	if err != nil {
+		return info, err
 	}
+	defer release()
 
-	ctx, done, err := c.cli.WithLease(c.ctx)
+	ctx, done, err := c.withLease(c.ctx)
 	if err != nil {
 		c.log.Errorf("failed to create lease to get snapshot: %v", err)
 		return info, err
@@ -76,11 +79,13 @@ func (c *OCIStore) GetSnapshot(key string) (_ snapshots.Info, retErr error) {
 }
 
 func (c *OCIStore) UpdateSnapshot(info snapshots.Info, fieldpaths ...string) (_ snapshots.Info, retErr error) {
-	if !c.IsInitiated() {
-		return info, errors.New(missInitErrMsg)
+	release, err := c.startWriteOp()
+	if err != nil {
+		return info, err
 	}
+	defer release()
 
-	ctx, done, err := c.cli.WithLease(c.ctx)
+	ctx, done, err := c.withLease(c.ctx)
 	if err != nil {
 		c.log.Errorf("failed to create lease to update snapshot: %v", err)
 		return info, err
@@ -103,11 +108,13 @@ func (c *OCIStore) UpdateSnapshot(info snapshots.Info, fieldpaths ...string) (_
 }
 
 func (c *OCIStore) LabelSnapshot(name string, labels map[string]string) (retErr error) {
-	if !c.IsInitiated() {
-		return errors.New(missInitErrMsg)
+	release, err := c.startWriteOp()
+	if err != nil {
+		return err
 	}
+	defer release()
 
-	ctx, done, err := c.cli.WithLease(c.ctx)
+	ctx, done, err := c.withLease(c.ctx)
 	if err != nil {
 		c.log.Errorf("failed to create lease to get snapshot: %v", err)
 		return err
@@ -136,11 +143,13 @@ func (c *OCIStore) LabelSnapshot(name string, labels map[string]string) (retErr
 }
 
 func (c *OCIStore) RemoveSnapshotLabels(name string, labelKeys ...string) (retErr error) {
-	if !c.IsInitiated() {
-		return errors.New(missInitErrMsg)
+	release, err := c.startWriteOp()
+	if err != nil {
+		return err
 	}
+	defer release()
 
-	ctx, done, err := c.cli.WithLease(c.ctx)
+	ctx, done, err := c.withLease(c.ctx)
 	if err != nil {
 		c.log.Errorf("failed to create lease to get snapshot: %v", err)
 		return err
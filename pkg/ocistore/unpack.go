@@ -18,7 +18,6 @@ package ocistore
 
 import (
 	"context"
-	"errors"
 
 	"github.com/containerd/containerd/v2/client"
 	"github.com/containerd/containerd/v2/core/diff"
@@ -29,11 +28,13 @@ import (
 )
 
 func (c *OCIStore) Unpack(img client.Image, opts ...ApplyCommitOpt) (retErr error) {
-	if !c.IsInitiated() {
-		return errors.New(missInitErrMsg)
+	release, err := c.startWriteOp()
+	if err != nil {
+		return err
 	}
+	defer release()
 
-	ctx, done, err := c.cli.WithLease(c.ctx)
+	ctx, done, err := c.withLease(c.ctx)
 	if err != nil {
 		c.log.Errorf("failed to create lease for unpacking '%s': %v", img.Name(), err)
 		return err
@@ -56,24 +57,30 @@ func (c *OCIStore) Unpack(img client.Image, opts ...ApplyCommitOpt) (retErr erro
 }
 
 func (c *OCIStore) unpack(ctx context.Context, img client.Image, opts ...ApplyCommitOpt) error {
-	if ok, err := img.IsUnpacked(ctx, c.driver); !ok {
+	cOpt := &ApplyCommitOpts{
+		sOpts: []snapshots.Opt{},
+		aOpts: []diff.ApplyOpt{},
+	}
+	for _, o := range opts {
+		err := o(cOpt)
 		if err != nil {
 			return err
 		}
+	}
 
-		cOpt := &ApplyCommitOpts{
-			sOpts: []snapshots.Opt{},
-			aOpts: []diff.ApplyOpt{},
-		}
-		for _, o := range opts {
-			err := o(cOpt)
-			if err != nil {
-				return err
-			}
+	// Images keep the platform they were selected for unless another one is requested
+	if cOpt.platform != nil {
+		img = client.NewImageWithPlatform(c.cli, img.Metadata(), cOpt.platform)
+	}
+	platform := img.Platform()
+
+	if ok, err := img.IsUnpacked(ctx, c.driver); !ok {
+		if err != nil {
+			return err
 		}
 
 		uPlat := unpack.Platform{
-			Platform:       c.platform,
+			Platform:       platform,
 			SnapshotterKey: c.driver,
 			Snapshotter:    c.cli.SnapshotService(c.driver),
 			SnapshotOpts:   cOpt.sOpts,
@@ -92,7 +99,7 @@ func (c *OCIStore) unpack(ctx context.Context, img client.Image, opts ...ApplyCo
 			return images.Children(ctx, c.cli.ContentStore(), desc)
 		}
 		var handler images.Handler
-		handler = images.Handlers(images.FilterPlatforms(handlerFunc, c.platform))
+		handler = images.Handlers(images.FilterPlatforms(handlerFunc, platform))
 
 		handler = unpacker.Unpack(handler)
 
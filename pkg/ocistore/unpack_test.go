@@ -0,0 +1,72 @@
+/*
+Copyright © 2024 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocistore
+
+import (
+	"testing"
+
+	"github.com/containerd/containerd/v2/client"
+	"github.com/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestUnpackPlatform(t *testing.T) {
+	host := platforms.DefaultSpec()
+	other := ocispec.Platform{OS: "linux", Architecture: "riscv64"}
+	if platforms.Only(host).Match(other) {
+		other.Architecture = "s390x"
+	}
+
+	cs := newTestStore(t, t.TempDir())
+	archive := writeTestArchive(t, "test/multi:latest", []ocispec.Platform{host, other}, testLayer{"file": "data"})
+	if _, err := cs.ImportFile(archive, WithImportPlatforms(host, other)); err != nil {
+		t.Fatal(err)
+	}
+	meta, err := cs.cli.ImageService().Get(cs.ctx, "test/multi:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostImg := client.NewImageWithPlatform(cs.cli, meta, platforms.OnlyStrict(host))
+	otherImg := client.NewImageWithPlatform(cs.cli, meta, platforms.OnlyStrict(other))
+	unpacked := func(img client.Image) bool {
+		t.Helper()
+		ok, err := img.IsUnpacked(cs.ctx, cs.driver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	// Images are unpacked for the platform they were selected for
+	if err = cs.Unpack(otherImg); err != nil {
+		t.Fatal(err)
+	}
+	if !unpacked(otherImg) {
+		t.Errorf("image not unpacked for the selected platform '%s'", platforms.Format(other))
+	}
+	if unpacked(hostImg) {
+		t.Error("image unpacked for the store platform instead of the selected one")
+	}
+
+	// Unless another platform is requested
+	if err = cs.Unpack(otherImg, WithUnpackPlatform(host)); err != nil {
+		t.Fatal(err)
+	}
+	if !unpacked(hostImg) {
+		t.Errorf("image not unpacked for the requested platform '%s'", platforms.Format(host))
+	}
+}